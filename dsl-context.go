@@ -0,0 +1,72 @@
+package mydslgo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var inheritedKeys = []string{"processId", "storeNamespace", "sandbox"}
+
+func inheritedValues(container map[string]interface{}) map[string]interface{} {
+	values := map[string]interface{}{}
+	for _, key := range inheritedKeys {
+		if value, ok := container[key]; ok {
+			values[key] = value
+		}
+	}
+	return values
+}
+
+func containerContext(container map[string]interface{}) context.Context {
+	if ctx, ok := container["context"].(context.Context); ok {
+		return ctx
+	}
+	return context.Background()
+}
+
+func checkContext(container map[string]interface{}) error {
+	if err := containerContext(container).Err(); err != nil {
+		return errors.New(fmt.Sprintf("evaluation cancelled: %v", err))
+	}
+	return nil
+}
+
+func sleepContext(ctx context.Context, duration time.Duration) error {
+	timer := time.NewTimer(duration)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func init() {
+	DslFunctions["withTimeout"] = func(container map[string]interface{}, args ...Argument) (interface{}, error) {
+		evaluated, err := args[0].Evaluate(container)
+		if err != nil {
+			return nil, err
+		}
+		timeout, err := toDuration(evaluated)
+		if err != nil {
+			return nil, err
+		}
+		parent, hadParent := container["context"]
+		ctx, cancel := context.WithTimeout(containerContext(container), timeout)
+		defer cancel()
+		container["context"] = ctx
+		result, err := args[1].Evaluate(container)
+		if hadParent {
+			container["context"] = parent
+		} else {
+			delete(container, "context")
+		}
+		if ctx.Err() == context.DeadlineExceeded {
+			return nil, errors.New(fmt.Sprintf("withTimeout: exceeded %v", timeout))
+		}
+		return result, err
+	}
+}
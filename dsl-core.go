@@ -1,12 +1,16 @@
 package mydslgo
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"gopkg.in/yaml.v2"
+	"io"
 	"io/ioutil"
 	"net/http"
+	"net/url"
 	"reflect"
 	"regexp"
 	"strconv"
@@ -124,6 +128,9 @@ func propertyGet(parent interface{}, key interface{}) (interface{}, error) {
 			case map[string]interface{}:
 				return typedParent[typedKey], nil
 			}
+			if result, ok, err := objectGet(parent, typedKey); ok {
+				return result, err
+			}
 			tryValue := reflect.ValueOf(parent).MethodByName(key.(string))
 			if tryValue.IsValid() {
 				return tryValue.Interface(), nil
@@ -162,6 +169,9 @@ func getLastKeyValue(container map[string]interface{}, arg Argument, root map[st
 		if rawArgStr == "$" {
 			return []interface{}{"", root}, nil
 		} else if val, ok := DslAvailableFunctions[rawArgStr]; ok {
+			if err := checkGoFunction(container, rawArgStr); err != nil {
+				return nil, err
+			}
 			return []interface{}{"", val}, nil
 		} else if !strings.Contains(rawArgStr, ".") && !strings.Contains(rawArgStr, "[") {
 			return []interface{}{"", rawArgStr}, nil
@@ -273,6 +283,162 @@ func mapMethod(this []interface{}, f func(interface{}) interface{}) []interface{
 	return mapped
 }
 
+func toDuration(any interface{}) (time.Duration, error) {
+	switch value := any.(type) {
+	case string:
+		return time.ParseDuration(value)
+	case int:
+		return time.Duration(value) * time.Second, nil
+	case float64:
+		return time.Duration(value * float64(time.Second)), nil
+	}
+	return 0, errors.New(fmt.Sprintf("toDuration() argument must be int seconds or duration string. %v", any))
+}
+
+func toJsonCompatible(any interface{}) interface{} {
+	switch value := any.(type) {
+	case map[interface{}]interface{}:
+		result := map[string]interface{}{}
+		for k, v := range value {
+			result[fmt.Sprint(k)] = toJsonCompatible(v)
+		}
+		return result
+	case map[string]interface{}:
+		result := map[string]interface{}{}
+		for k, v := range value {
+			result[k] = toJsonCompatible(v)
+		}
+		return result
+	case []interface{}:
+		result := make([]interface{}, len(value))
+		for i, v := range value {
+			result[i] = toJsonCompatible(v)
+		}
+		return result
+	}
+	return any
+}
+
+func newHttpRequest(ctx context.Context, method string, rawUrl string, options map[string]interface{}) (*http.Request, error) {
+	parsedUrl, err := url.Parse(rawUrl)
+	if err != nil {
+		return nil, err
+	}
+	if query, ok := toStringKeyMap(options["query"]); ok {
+		values := parsedUrl.Query()
+		for key, value := range query {
+			for _, item := range toInterfaceSlice(value) {
+				values.Add(key, fmt.Sprint(item))
+			}
+		}
+		parsedUrl.RawQuery = values.Encode()
+	}
+	var body io.Reader
+	contentType := ""
+	if jsonBody, ok := options["json"]; ok {
+		b, err := json.Marshal(toJsonCompatible(jsonBody))
+		if err != nil {
+			return nil, err
+		}
+		body = bytes.NewReader(b)
+		contentType = "application/json"
+	} else if form, ok := toStringKeyMap(options["form"]); ok {
+		values := url.Values{}
+		for key, value := range form {
+			for _, item := range toInterfaceSlice(value) {
+				values.Add(key, fmt.Sprint(item))
+			}
+		}
+		body = strings.NewReader(values.Encode())
+		contentType = "application/x-www-form-urlencoded"
+	} else if rawBody, ok := options["body"]; ok && rawBody != nil {
+		body = strings.NewReader(fmt.Sprint(rawBody))
+	}
+	req, err := http.NewRequestWithContext(ctx, method, parsedUrl.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if headers, ok := toStringKeyMap(options["headers"]); ok {
+		for key, value := range headers {
+			req.Header.Set(key, fmt.Sprint(value))
+		}
+	}
+	return req, nil
+}
+
+func doHttpRequest(ctx context.Context, method string, rawUrl string, options map[string]interface{}) (map[string]interface{}, error) {
+	client := &http.Client{}
+	if timeout, ok := options["timeout"]; ok {
+		duration, err := toDuration(timeout)
+		if err != nil {
+			return nil, err
+		}
+		client.Timeout = duration
+	}
+	retries := 0
+	if rawRetries, ok := options["retries"]; ok {
+		typedRetries, err := toInt(rawRetries)
+		if err != nil {
+			return nil, err
+		}
+		retries = typedRetries
+	}
+	backoff := 100 * time.Millisecond
+	if rawBackoff, ok := options["backoff"]; ok {
+		duration, err := toDuration(rawBackoff)
+		if err != nil {
+			return nil, err
+		}
+		backoff = duration
+	}
+	var lastErr error
+	for attempt := 0; attempt <= retries; attempt++ {
+		if attempt > 0 {
+			if err := sleepContext(ctx, backoff); err != nil {
+				return nil, err
+			}
+			backoff *= 2
+		}
+		req, err := newHttpRequest(ctx, method, rawUrl, options)
+		if err != nil {
+			return nil, err
+		}
+		response, err := client.Do(req)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, err
+			}
+			lastErr = err
+			continue
+		}
+		byteArray, err := ioutil.ReadAll(response.Body)
+		response.Body.Close()
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if response.StatusCode >= 500 && attempt < retries {
+			lastErr = errors.New(fmt.Sprintf("request: %v %v returned %v", method, rawUrl, response.StatusCode))
+			continue
+		}
+		result := map[string]interface{}{
+			"status":  response.StatusCode,
+			"headers": valuesToMap(response.Header),
+			"body":    string(byteArray),
+			"json":    nil,
+		}
+		var any interface{}
+		if json.Unmarshal(byteArray, &any) == nil {
+			result["json"] = any
+		}
+		return result, nil
+	}
+	return nil, lastErr
+}
+
 func (this Argument) Evaluate(container map[string]interface{}) (interface{}, error) {
 	switch typedArg := this.rawArg.(type) {
 	case string:
@@ -280,8 +446,9 @@ func (this Argument) Evaluate(container map[string]interface{}) (interface{}, er
 			return container, nil
 		} else if comparePattern.MatchString(typedArg) {
 			match := comparePattern.FindStringSubmatch(typedArg)
-			return DslFunctions["compare"](
+			return callBuiltin(
 				container,
+				"compare",
 				NewArgument(match[2]),
 				NewArgument(match[1]),
 				NewArgument(match[3]))
@@ -302,13 +469,16 @@ func (this Argument) Evaluate(container map[string]interface{}) (interface{}, er
 			default:
 			}
 			if key != "" {
-				return DslFunctions[key](container, NewArgument(match[1]), NewArgument(match[3]))
+				return callBuiltin(container, key, NewArgument(match[1]), NewArgument(match[3]))
 			}
 		} else if strings.HasPrefix(typedArg, "$") {
-			return DslFunctions["get"](container, NewArgument(typedArg))
+			return callBuiltin(container, "get", NewArgument(typedArg))
 		} else {
 			_func, ok := DslAvailableFunctions[typedArg]
 			if ok {
+				if err := checkGoFunction(container, typedArg); err != nil {
+					return nil, err
+				}
 				return _func, nil
 			}
 		}
@@ -328,16 +498,14 @@ func (this Argument) Evaluate(container map[string]interface{}) (interface{}, er
 			return map[string]interface{}{}, nil
 		} else if len(typedArg) == 1 {
 			key := getFirstKey(typedArg)
-			f, ok := DslFunctions[key]
-			if ok {
+			if _, ok := DslFunctions[key]; ok {
 				wrapped := []Argument{}
 				for _, rawArg := range asArray(typedArg[key]) {
 					wrapped = append(wrapped, NewArgument(rawArg))
 				}
-				result, err := f(container, wrapped...)
-				return result, err // TBD
+				return callBuiltin(container, key, wrapped...)
 			} else if strings.HasPrefix(key, "$") {
-				return DslFunctions["set"](container, NewArgument(key), Argument{typedArg[key]})
+				return callBuiltin(container, "set", NewArgument(key), Argument{typedArg[key]})
 			}
 		} else {
 			result := map[string]interface{}{}
@@ -360,6 +528,10 @@ func init() {
 	DslFunctions["print"] = func(container map[string]interface{}, args ...Argument) (interface{}, error) {
 		evaluated, err := evaluateAll(args, container)
 		if err == nil {
+			if output := containerProcessLog(container); output != nil {
+				output.write("stdout", fmt.Sprintln(evaluated...))
+				return nil, nil
+			}
 			fmt.Println(evaluated...)
 			return nil, nil
 		} else {
@@ -386,6 +558,8 @@ func init() {
 				numKey, numOk := strconv.Atoi(typedKey)
 				if numOk == nil {
 					parentValue.([]interface{})[numKey] = evaluated
+				} else if ok, err := objectSet(parentValue, typedKey, evaluated); ok {
+					return nil, err
 				} else {
 					parentValue.(map[string]interface{})[typedKey] = evaluated
 					//fmt.Println("here?", parentValue)
@@ -438,6 +612,13 @@ func init() {
 							case map[string]interface{}:
 								cursor = typedParentValue[typedKey]
 							default:
+								if result, ok, err := objectGet(parentValue, typedKey); ok {
+									if err != nil {
+										return nil, err
+									}
+									cursor = result
+									break
+								}
 								cursor = parentValue.(map[interface{}]interface{})[typedKey]
 							}
 						}
@@ -486,7 +667,10 @@ func init() {
 		if key == "" {
 			cursor = parentValue
 		} else {
-			result, _ := propertyGet(parentValue, key)
+			result, err := propertyGet(parentValue, key)
+			if err != nil {
+				return nil, err
+			}
 			cursor = result
 		}
 		for isFunc(cursor) == false && len(args) > 0 {
@@ -506,9 +690,7 @@ func init() {
 			if err != nil {
 				return nil, err
 			}
-			reflectValues := toReflectValues(evaluated)
-			callResult := reflect.ValueOf(cursor).Call(reflectValues)
-			return stripCallResult(callResult), nil
+			return callFunction(cursor, evaluated)
 		} else {
 			return nil, nil
 		}
@@ -557,6 +739,9 @@ func init() {
 		}
 		slice := toInterfaceSlice(any)
 		for index, value := range slice {
+			if err := checkContext(container); err != nil {
+				return nil, err
+			}
 			_self[key] = value
 			_self["index"] = index
 			args[1].Evaluate(_self)
@@ -577,6 +762,9 @@ func init() {
 		slice := toInterfaceSlice(any)
 		sliceSize := len(slice)
 		for index, value := range slice {
+			if err := checkContext(container); err != nil {
+				return nil, err
+			}
 			_self[key] = value
 			_self["index"] = index
 			evaluated, err := args[1].Evaluate(_self)
@@ -608,6 +796,9 @@ func init() {
 		slice := toInterfaceSlice(any)
 		sliceSize := len(slice)
 		for index, value := range slice {
+			if err := checkContext(container); err != nil {
+				return nil, err
+			}
 			_self[key] = value
 			_self["index"] = index
 			evaluated, err := args[1].Evaluate(_self)
@@ -679,24 +870,39 @@ func init() {
 	}
 
 	DslFunctions["request"] = func(container map[string]interface{}, args ...Argument) (interface{}, error) {
-		if args[0].rawArg.(string) == "get" {
-			evaluated, err := args[1].Evaluate(container)
-			if err != err {
-				return nil, err
-			}
-			url := evaluated.(string)
-			response, _ := http.Get(url)
-			defer response.Body.Close()
-			byteArray, _ := ioutil.ReadAll(response.Body)
-			if len(args) > 2 && args[2].rawArg.(string) == "json" {
-				var any interface{}
-				json.Unmarshal(byteArray, &any)
-				return any, nil
-			} else {
-				return string(byteArray), nil
+		method, ok := args[0].rawArg.(string)
+		if !ok {
+			return nil, errors.New(fmt.Sprintf("request method must be string. %v", args[0].rawArg))
+		}
+		evaluated, err := args[1].Evaluate(container)
+		if err != nil {
+			return nil, err
+		}
+		url, ok := evaluated.(string)
+		if !ok {
+			return nil, errors.New(fmt.Sprintf("request url must be string. %v", evaluated))
+		}
+		if len(args) > 2 {
+			if _, ok := args[2].rawArg.(string); !ok {
+				evaluatedOptions, err := args[2].Evaluate(container)
+				if err != nil {
+					return nil, err
+				}
+				options, ok := toStringKeyMap(evaluatedOptions)
+				if !ok {
+					return nil, errors.New(fmt.Sprintf("request options must be map. %v", evaluatedOptions))
+				}
+				return doHttpRequest(containerContext(container), strings.ToUpper(method), url, options)
 			}
+		}
+		response, err := doHttpRequest(containerContext(container), strings.ToUpper(method), url, map[string]interface{}{})
+		if err != nil {
+			return nil, err
+		}
+		if len(args) > 2 && args[2].rawArg.(string) == "json" {
+			return response["json"], nil
 		} else {
-			return nil, nil
+			return response["body"], nil
 		}
 	}
 
@@ -706,6 +912,10 @@ func init() {
 		}
 		seqIndex := len(container["seqArray"].([]interface{}))
 		for _, arg := range args {
+			if err := checkContext(container); err != nil {
+				container["seqArray"] = (container["seqArray"].([]interface{}))[0:seqIndex]
+				return nil, err
+			}
 			evaluated, err := arg.Evaluate(container)
 			if err != err {
 				return nil, err
@@ -733,9 +943,11 @@ func init() {
 
 	DslFunctions["timer"] = func(container map[string]interface{}, args ...Argument) (interface{}, error) {
 		exitChannel := make(chan int)
+		ctx := containerContext(container)
 		go func() {
 			args[1].Evaluate(container)
 			ticker := time.NewTicker(time.Duration(args[0].rawArg.(int)) * time.Second)
+			defer ticker.Stop()
 			for {
 				select {
 				case <-ticker.C:
@@ -743,6 +955,10 @@ func init() {
 				case <-exitChannel:
 					fmt.Println("exit timer")
 					return
+				case <-ctx.Done():
+					fmt.Println("timer cancelled", ctx.Err())
+					reportWorkerExit(container, exitChannel, ctx.Err())
+					return
 				}
 			}
 		}()
@@ -880,12 +1096,31 @@ func init() {
 		if err != nil {
 			return nil, err
 		}
+		var profile *sandboxProfile
+		if len(args) > 1 {
+			rawProfile, err := args[1].Evaluate(container)
+			if err != nil {
+				return nil, err
+			}
+			profile, err = resolveSandboxProfile(rawProfile)
+			if err != nil {
+				return nil, err
+			}
+		}
 		var objInput map[interface{}]interface{}
 		yamlError := yaml.UnmarshalStrict([]byte(evaluated.(string)), &objInput)
 		if yamlError != nil {
 			fmt.Println("unmarshal error:", err)
 		}
-		go NewArgument(objInput).Evaluate(map[string]interface{}{})
+		root := map[string]interface{}{}
+		s := newSandbox(profile, containerSandbox(container))
+		cancel := s.bind(root)
+		go func() {
+			defer cancel()
+			if _, err := s.result(NewArgument(objInput).Evaluate(root)); err != nil {
+				fmt.Println("runYaml:", err)
+			}
+		}()
 		return nil, nil
 	}
 
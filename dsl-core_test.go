@@ -0,0 +1,116 @@
+package mydslgo
+
+import (
+	"encoding/json"
+	"gopkg.in/yaml.v2"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func evaluateYaml(t *testing.T, container map[string]interface{}, src string) (interface{}, error) {
+	t.Helper()
+	var parsed interface{}
+	if err := yaml.Unmarshal([]byte(src), &parsed); err != nil {
+		t.Fatal(err)
+	}
+	return NewArgument(parsed).Evaluate(container)
+}
+
+func mustEvaluateYaml(t *testing.T, container map[string]interface{}, src string) interface{} {
+	t.Helper()
+	result, err := evaluateYaml(t, container, src)
+	if err != nil {
+		t.Fatalf("%v: %v", src, err)
+	}
+	return result
+}
+
+func TestRequestAgainstServer(t *testing.T) {
+	attempts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/flaky":
+			attempts++
+			if attempts < 3 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+		case "/slow":
+			time.Sleep(200 * time.Millisecond)
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		w.Header().Add("X-Multi", "a")
+		w.Header().Add("X-Multi", "b")
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"method":      r.Method,
+			"query":       r.URL.RawQuery,
+			"token":       r.Header.Get("X-Token"),
+			"contentType": r.Header.Get("Content-Type"),
+			"body":        string(body),
+		})
+	}))
+	defer server.Close()
+	container := map[string]interface{}{"url": server.URL}
+
+	response := mustEvaluateYaml(t, container, `
+request:
+  - put
+  - $.url
+  - json: {name: apple}
+    query: {q: [a, b]}
+    headers: {X-Token: secret}
+`).(map[string]interface{})
+	if response["status"] != 200 {
+		t.Fatalf("unexpected status: %v", response["status"])
+	}
+	expected := map[string]interface{}{"method": "PUT", "query": "q=a&q=b", "token": "secret", "contentType": "application/json", "body": "{\"name\":\"apple\"}"}
+	if !reflect.DeepEqual(response["json"], expected) {
+		t.Fatalf("unexpected echo: %v", response["json"])
+	}
+	headers := response["headers"].(map[string]interface{})
+	if !reflect.DeepEqual(headers["X-Multi"], []interface{}{"a", "b"}) || headers["Content-Type"] != "application/json" {
+		t.Fatalf("unexpected headers: %v", headers)
+	}
+
+	response = mustEvaluateYaml(t, container, `
+request:
+  - post
+  - $.url
+  - form: {a: 1}
+    headers: {X-Token: t}
+`).(map[string]interface{})
+	if echo := response["json"].(map[string]interface{}); echo["body"] != "a=1" || echo["contentType"] != "application/x-www-form-urlencoded" {
+		t.Fatalf("unexpected form echo: %v", echo)
+	}
+
+	container["flaky"] = server.URL + "/flaky"
+	response = mustEvaluateYaml(t, container, `
+request:
+  - get
+  - $.flaky
+  - retries: 3
+    backoff: 1ms
+`).(map[string]interface{})
+	if response["status"] != 200 || attempts != 3 {
+		t.Fatalf("expected success on third attempt, got %v after %v attempts", response["status"], attempts)
+	}
+
+	container["slow"] = server.URL + "/slow"
+	if _, err := evaluateYaml(t, container, `
+request:
+  - get
+  - $.slow
+  - timeout: 20ms
+    retries: 0
+`); err == nil {
+		t.Fatal("expected timeout error")
+	}
+	if _, err := evaluateYaml(t, container, "withTimeout: [20ms, {request: [get, $.slow]}]"); err == nil {
+		t.Fatal("expected cancelled request")
+	}
+}
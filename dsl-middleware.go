@@ -0,0 +1,193 @@
+package mydslgo
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/go-chi/chi"
+	"github.com/go-chi/chi/middleware"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+type middlewareContextKey struct{}
+
+type trackingResponseWriter struct {
+	http.ResponseWriter
+	written bool
+}
+
+func (w *trackingResponseWriter) WriteHeader(status int) {
+	w.written = true
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *trackingResponseWriter) Write(b []byte) (int, error) {
+	w.written = true
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *trackingResponseWriter) Flush() {
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (w *trackingResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("response does not support hijacking.")
+	}
+	w.written = true
+	return hijacker.Hijack()
+}
+
+var middlewareScopeKeys = func() map[string]bool {
+	keys := map[string]bool{"req": true, "res": true, "request": true, "context": true, "exit": true, "sandboxDepth": true}
+	for _, key := range inheritedKeys {
+		keys[key] = true
+	}
+	return keys
+}()
+
+func middlewareValues(req *http.Request) map[string]interface{} {
+	values, _ := req.Context().Value(middlewareContextKey{}).(map[string]interface{})
+	return values
+}
+
+func dslMiddleware(arg Argument, inherited map[string]interface{}) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+			request, err := requestObject(req)
+			if err != nil {
+				http.Error(res, err.Error(), http.StatusBadRequest)
+				return
+			}
+			tracking := &trackingResponseWriter{ResponseWriter: res}
+			newContainer := map[string]interface{}{"req": req, "res": tracking, "request": request, "context": req.Context()}
+			for key, value := range inherited {
+				newContainer[key] = value
+			}
+			for key, value := range middlewareValues(req) {
+				newContainer[key] = value
+			}
+			if _, err := arg.Evaluate(newContainer); err != nil {
+				log.Println("middleware:", err)
+				if !tracking.written {
+					http.Error(res, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+				}
+				return
+			}
+			if tracking.written || newContainer["exit"] == true {
+				return
+			}
+			values := map[string]interface{}{}
+			for key, value := range newContainer {
+				if !middlewareScopeKeys[key] {
+					values[key] = value
+				}
+			}
+			ctx := context.WithValue(req.Context(), requestBodyContextKey{}, parsedRequestBody{request["body"]})
+			next.ServeHTTP(res, req.WithContext(context.WithValue(ctx, middlewareContextKey{}, values)))
+		})
+	}
+}
+
+func corsMiddleware(options map[string]interface{}) func(http.Handler) http.Handler {
+	joined := func(key string, defaultValue string) string {
+		if options[key] == nil {
+			return defaultValue
+		}
+		items := []string{}
+		for _, item := range toInterfaceSlice(options[key]) {
+			items = append(items, fmt.Sprint(item))
+		}
+		return strings.Join(items, ", ")
+	}
+	origins := map[string]bool{}
+	if options["origins"] != nil {
+		for _, origin := range toInterfaceSlice(options["origins"]) {
+			origins[fmt.Sprint(origin)] = true
+		}
+	} else {
+		origins["*"] = true
+	}
+	methods := joined("methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
+	headers := joined("headers", "Content-Type, Authorization")
+	credentials, _ := options["credentials"].(bool)
+	maxAge, _ := options["maxAge"].(int)
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+			origin := req.Header.Get("Origin")
+			if origin != "" && (origins["*"] || origins[origin]) {
+				if origins["*"] && !credentials {
+					res.Header().Set("Access-Control-Allow-Origin", "*")
+				} else {
+					res.Header().Set("Access-Control-Allow-Origin", origin)
+					res.Header().Add("Vary", "Origin")
+				}
+				if credentials {
+					res.Header().Set("Access-Control-Allow-Credentials", "true")
+				}
+				if req.Method == http.MethodOptions && req.Header.Get("Access-Control-Request-Method") != "" {
+					res.Header().Set("Access-Control-Allow-Methods", methods)
+					res.Header().Set("Access-Control-Allow-Headers", headers)
+					if maxAge > 0 {
+						res.Header().Set("Access-Control-Max-Age", strconv.Itoa(maxAge))
+					}
+					res.WriteHeader(http.StatusNoContent)
+					return
+				}
+			}
+			next.ServeHTTP(res, req)
+		})
+	}
+}
+
+func middlewareFor(container map[string]interface{}, args []Argument) (func(http.Handler) http.Handler, error) {
+	name, ok := args[0].rawArg.(string)
+	if !ok {
+		return dslMiddleware(args[0], inheritedValues(container)), nil
+	}
+	switch name {
+	case "logger":
+		return middleware.Logger, nil
+	case "recoverer":
+		return middleware.Recoverer, nil
+	case "cors":
+		options := map[string]interface{}{}
+		if len(args) > 1 {
+			evaluated, err := args[1].Evaluate(container)
+			if err != nil {
+				return nil, err
+			}
+			typedOptions, ok := toStringKeyMap(evaluated)
+			if !ok {
+				return nil, errors.New(fmt.Sprintf("cors options must be map. %v", evaluated))
+			}
+			options = typedOptions
+		}
+		return corsMiddleware(options), nil
+	}
+	return nil, errors.New(fmt.Sprintf("middleware not found: %v", name))
+}
+
+func init() {
+	DslFunctions["middleware"] = func(container map[string]interface{}, args ...Argument) (interface{}, error) {
+		router, ok := container["router"].(chi.Router)
+		if !ok {
+			return nil, errors.New("middleware: router is not set.")
+		}
+		handler, err := middlewareFor(container, args)
+		if err != nil {
+			return nil, err
+		}
+		return nil, routerCall("middleware", func() {
+			router.Use(handler)
+		})
+	}
+}
@@ -2,9 +2,11 @@ package mydslgo
 
 import (
 	"context"
-	_ "fmt"
+	"errors"
+	"fmt"
 	"github.com/mongodb/mongo-go-driver/bson"
 	"github.com/mongodb/mongo-go-driver/mongo"
+	"github.com/mongodb/mongo-go-driver/mongo/options"
 	"log"
 	//	"reflect"
 	"os"
@@ -24,13 +26,17 @@ func init() {
 	DslFunctions["mongoGet"] = func(container map[string]interface{}, args ...Argument) (interface{}, error) {
 		collectionName := args[0].rawArg.(string)
 		collection := client.Database(dbname).Collection(collectionName)
-		cur, err := collection.Find(ctx, bson.D{})
+		requestCtx := containerContext(container)
+		cur, err := collection.Find(requestCtx, bson.D{})
 		if err != nil {
+			if requestCtx.Err() != nil {
+				return nil, err
+			}
 			log.Fatal(err)
 		}
 		records := []map[string]interface{}{}
 		defer cur.Close(ctx)
-		for cur.Next(ctx) {
+		for cur.Next(requestCtx) {
 			var result map[string]interface{}
 			err := cur.Decode(&result)
 			if err != nil {
@@ -39,8 +45,14 @@ func init() {
 			records = append(records, result)
 		}
 		if err := cur.Err(); err != nil {
+			if requestCtx.Err() != nil {
+				return nil, err
+			}
 			log.Fatal(err)
 		}
+		if err := requestCtx.Err(); err != nil {
+			return nil, err
+		}
 		return records, nil
 	}
 
@@ -50,8 +62,11 @@ func init() {
 		if err != nil {
 			return nil, err
 		}
+		if err := validateCollection(collectionName, obj); err != nil {
+			return nil, err
+		}
 		collection := client.Database(dbname).Collection(collectionName)
-		res, err := collection.InsertOne(ctx, obj)
+		res, err := collection.InsertOne(containerContext(container), obj)
 		if err != nil {
 			return nil, err
 		}
@@ -64,8 +79,82 @@ func init() {
 		if err != nil {
 			return nil, err
 		}
+		if err := validateCollection(collectionName, obj); err != nil {
+			return nil, err
+		}
 		collection := client.Database(dbname).Collection(collectionName)
-		res := collection.FindOneAndReplace(ctx, map[string]interface{}{"_id": (obj.(map[string]interface{}))["_id"]}, obj)
+		res := collection.FindOneAndReplace(containerContext(container), map[string]interface{}{"_id": (obj.(map[string]interface{}))["_id"]}, obj)
 		return res, nil
 	}
+
+	DslFunctions["mongoWatch"] = func(container map[string]interface{}, args ...Argument) (interface{}, error) {
+		collectionName, ok := args[0].rawArg.(string)
+		if !ok {
+			return nil, errors.New(fmt.Sprintf("mongoWatch collection name must be string. %v", args[0].rawArg))
+		}
+		pipeline := []interface{}{}
+		if len(args) > 2 {
+			evaluated, err := args[1].Evaluate(container)
+			if err != nil {
+				return nil, err
+			}
+			if evaluated != nil {
+				pipeline = toInterfaceSlice(evaluated)
+			}
+		}
+		target := args[len(args)-1]
+		collection := client.Database(dbname).Collection(collectionName)
+		inherited := inheritedValues(container)
+		watchCtx, cancel := context.WithCancel(containerContext(container))
+		stream, err := collection.Watch(watchCtx, pipeline, options.ChangeStream().SetFullDocument(options.UpdateLookup))
+		if err != nil {
+			cancel()
+			return nil, err
+		}
+		exitChannel := make(chan int)
+		go func() {
+			select {
+			case <-exitChannel:
+			case <-watchCtx.Done():
+			}
+			cancel()
+		}()
+		go func() {
+			defer cancel()
+			defer stream.Close(context.Background())
+			for stream.Next(watchCtx) {
+				var change map[string]interface{}
+				if err := stream.Decode(&change); err != nil {
+					log.Println("mongoWatch decode:", err)
+					continue
+				}
+				newContainer := map[string]interface{}{"change": change, "collectionName": collectionName, "context": watchCtx}
+				for key, value := range inherited {
+					newContainer[key] = value
+				}
+				if channelName, ok := target.rawArg.(string); ok {
+					_, err = callBuiltin(newContainer, "publish", NewArgument(channelName), NewArgument("$.change"))
+				} else {
+					_, err = target.Evaluate(newContainer)
+				}
+				if err != nil {
+					log.Println("mongoWatch:", err)
+				}
+			}
+			streamErr := stream.Err()
+			if streamErr != nil && watchCtx.Err() == nil {
+				log.Println("mongoWatch stream:", streamErr)
+			}
+			fmt.Println("exit mongoWatch", collectionName)
+			select {
+			case <-exitChannel:
+			default:
+				if streamErr == nil {
+					streamErr = containerContext(container).Err()
+				}
+				reportWorkerExit(container, exitChannel, streamErr)
+			}
+		}()
+		return exitChannel, nil
+	}
 }
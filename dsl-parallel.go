@@ -0,0 +1,248 @@
+package mydslgo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+type parallelRun struct {
+	mutex   sync.Mutex
+	results []interface{}
+	errs    []error
+	first   int
+}
+
+type parallelSettings struct {
+	limit   int
+	collect bool
+	key     string
+}
+
+func childScope(container map[string]interface{}, ctx context.Context) map[string]interface{} {
+	child := make(map[string]interface{}, len(container)+1)
+	for key, value := range container {
+		switch key {
+		case "seqArray", "exit":
+		default:
+			child[key] = value
+		}
+	}
+	child["context"] = ctx
+	return child
+}
+
+func evaluateIsolated(body Argument, child map[string]interface{}) (result interface{}, err error) {
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			err = errors.New(fmt.Sprintf("panic: %v", recovered))
+		}
+	}()
+	return body.Evaluate(child)
+}
+
+func runParallel(container map[string]interface{}, bodies []Argument, setup func(int, map[string]interface{}), limit int, stop func(interface{}, error) bool) *parallelRun {
+	ctx, cancel := context.WithCancel(containerContext(container))
+	defer cancel()
+	children := make([]map[string]interface{}, len(bodies))
+	for index := range bodies {
+		children[index] = childScope(container, ctx)
+		if setup != nil {
+			setup(index, children[index])
+		}
+	}
+	run := &parallelRun{results: make([]interface{}, len(bodies)), errs: make([]error, len(bodies)), first: -1}
+	if limit <= 0 || limit > len(bodies) {
+		limit = len(bodies)
+	}
+	semaphore := make(chan struct{}, limit)
+	stopped := make(chan struct{})
+	wg := sync.WaitGroup{}
+	for index := range bodies {
+		if ctx.Err() != nil {
+			run.errs[index] = ctx.Err()
+			continue
+		}
+		select {
+		case semaphore <- struct{}{}:
+		case <-ctx.Done():
+			run.errs[index] = ctx.Err()
+			continue
+		}
+		wg.Add(1)
+		go func(index int) {
+			defer wg.Done()
+			defer func() { <-semaphore }()
+			result, err := evaluateIsolated(bodies[index], children[index])
+			if err == nil {
+				err = ctx.Err()
+			}
+			run.mutex.Lock()
+			defer run.mutex.Unlock()
+			if run.first >= 0 {
+				return
+			}
+			run.results[index], run.errs[index] = result, err
+			if stop(result, err) {
+				run.first = index
+				cancel()
+				close(stopped)
+			}
+		}(index)
+	}
+	finished := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(finished)
+	}()
+	select {
+	case <-finished:
+	case <-stopped:
+	}
+	return run
+}
+
+func (run *parallelRun) errorSummary() string {
+	messages := []string{}
+	for index, err := range run.errs {
+		if err != nil {
+			messages = append(messages, fmt.Sprintf("[%v] %v", index, err))
+		}
+	}
+	return strings.Join(messages, "; ")
+}
+
+func (run *parallelRun) value(name string, settings parallelSettings) (interface{}, error) {
+	if !settings.collect {
+		if run.first >= 0 {
+			return nil, errors.New(fmt.Sprintf("%v: body %v failed: %v", name, run.first, run.errs[run.first]))
+		}
+		return run.results, nil
+	}
+	errs := make([]interface{}, len(run.errs))
+	for index, err := range run.errs {
+		if err != nil {
+			errs[index] = err.Error()
+		}
+	}
+	return map[string]interface{}{"results": run.results, "errors": errs}, nil
+}
+
+func parallelOptions(container map[string]interface{}, args []Argument, index int) (parallelSettings, error) {
+	settings := parallelSettings{key: "item"}
+	if len(args) <= index {
+		return settings, nil
+	}
+	evaluated, err := args[index].Evaluate(container)
+	if err != nil {
+		return settings, err
+	}
+	if evaluated == nil {
+		return settings, nil
+	}
+	options, ok := toStringKeyMap(evaluated)
+	if !ok {
+		return settings, errors.New(fmt.Sprintf("parallel options must be map. %v", evaluated))
+	}
+	for key, value := range options {
+		switch key {
+		case "limit":
+			settings.limit, err = toInt(value)
+			if err != nil {
+				return settings, err
+			}
+		case "errors":
+			switch value {
+			case "failFast":
+				settings.collect = false
+			case "collect":
+				settings.collect = true
+			default:
+				return settings, errors.New(fmt.Sprintf("parallel errors must be failFast or collect. %v", value))
+			}
+		case "key":
+			settings.key = fmt.Sprint(value)
+		default:
+			return settings, errors.New(fmt.Sprintf("parallel unknown option: %v", key))
+		}
+	}
+	return settings, nil
+}
+
+func parallelBodies(name string, arg Argument) ([]Argument, error) {
+	rawBodies, ok := arg.rawArg.([]interface{})
+	if !ok {
+		return nil, errors.New(fmt.Sprintf("%v bodies must be list. %v", name, arg.rawArg))
+	}
+	bodies := []Argument{}
+	for _, rawBody := range rawBodies {
+		bodies = append(bodies, NewArgument(rawBody))
+	}
+	return bodies, nil
+}
+
+func failed(result interface{}, err error) bool {
+	return err != nil
+}
+
+func init() {
+	DslFunctions["parallel"] = func(container map[string]interface{}, args ...Argument) (interface{}, error) {
+		bodies, err := parallelBodies("parallel", args[0])
+		if err != nil {
+			return nil, err
+		}
+		settings, err := parallelOptions(container, args, 1)
+		if err != nil {
+			return nil, err
+		}
+		stop := failed
+		if settings.collect {
+			stop = func(interface{}, error) bool { return false }
+		}
+		return runParallel(container, bodies, nil, settings.limit, stop).value("parallel", settings)
+	}
+
+	DslFunctions["race"] = func(container map[string]interface{}, args ...Argument) (interface{}, error) {
+		bodies, err := parallelBodies("race", args[0])
+		if err != nil {
+			return nil, err
+		}
+		if len(bodies) == 0 {
+			return nil, nil
+		}
+		run := runParallel(container, bodies, nil, 0, func(result interface{}, err error) bool {
+			return err == nil
+		})
+		if run.first < 0 {
+			return nil, errors.New(fmt.Sprintf("race: all bodies failed: %v", run.errorSummary()))
+		}
+		return run.results[run.first], nil
+	}
+
+	DslFunctions["parallelMap"] = func(container map[string]interface{}, args ...Argument) (interface{}, error) {
+		evaluated, err := args[0].Evaluate(container)
+		if err != nil {
+			return nil, err
+		}
+		settings, err := parallelOptions(container, args, 2)
+		if err != nil {
+			return nil, err
+		}
+		slice := toInterfaceSlice(evaluated)
+		bodies := make([]Argument, len(slice))
+		for index := range slice {
+			bodies[index] = args[1]
+		}
+		setup := func(index int, child map[string]interface{}) {
+			child[settings.key] = slice[index]
+			child["index"] = index
+		}
+		stop := failed
+		if settings.collect {
+			stop = func(interface{}, error) bool { return false }
+		}
+		return runParallel(container, bodies, setup, settings.limit, stop).value("parallelMap", settings)
+	}
+}
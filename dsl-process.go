@@ -0,0 +1,485 @@
+package mydslgo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+type processLog struct {
+	mutex       sync.Mutex
+	capacity    int
+	lines       []map[string]interface{}
+	channelName string
+}
+
+type process struct {
+	id          string
+	dsl         interface{}
+	policy      string
+	backoff     time.Duration
+	maxRestarts int
+	status      string
+	err         string
+	restarts    int
+	startedAt   time.Time
+	stoppedAt   time.Time
+	exitChannel chan int
+	exited      map[chan int]error
+	stop        chan struct{}
+	ctx         context.Context
+	cancel      context.CancelFunc
+	release     context.CancelFunc
+	log         *processLog
+	profile     *sandboxProfile
+	sandbox     *sandbox
+}
+
+type supervisor struct {
+	mutex     sync.RWMutex
+	processes map[string]*process
+}
+
+const maxRestartBackoff = time.Minute
+
+var processSupervisor = &supervisor{processes: map[string]*process{}}
+
+func (l *processLog) write(stream string, text string) {
+	for _, line := range strings.Split(strings.TrimRight(text, "\n"), "\n") {
+		entry := map[string]interface{}{
+			"time":   int(time.Now().UnixNano() / int64(time.Millisecond)),
+			"stream": stream,
+			"line":   line,
+		}
+		l.mutex.Lock()
+		l.lines = append(l.lines, entry)
+		if len(l.lines) > l.capacity {
+			l.lines = append([]map[string]interface{}{}, l.lines[len(l.lines)-l.capacity:]...)
+		}
+		channelName := l.channelName
+		l.mutex.Unlock()
+		if channelName != "" {
+			pubsub.publish(channelName, entry)
+		}
+	}
+}
+
+func (l *processLog) tail(n int) []interface{} {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	start := 0
+	if n > 0 && n < len(l.lines) {
+		start = len(l.lines) - n
+	}
+	result := []interface{}{}
+	for _, entry := range l.lines[start:] {
+		result = append(result, entry)
+	}
+	return result
+}
+
+func (s *supervisor) logFor(id string) *processLog {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	if p, ok := s.processes[id]; ok {
+		return p.log
+	}
+	return nil
+}
+
+func containerProcessLog(container map[string]interface{}) *processLog {
+	id, ok := container["processId"].(string)
+	if !ok {
+		return nil
+	}
+	return processSupervisor.logFor(id)
+}
+
+func (p *process) logf(format string, args ...interface{}) {
+	text := fmt.Sprintf(format, args...)
+	fmt.Println(p.id+":", text)
+	p.log.write("supervisor", text)
+}
+
+func (p *process) evaluate() (exitChannel chan int, release context.CancelFunc, err error) {
+	container := map[string]interface{}{"processId": p.id, "context": p.ctx}
+	s := newSandbox(p.profile, p.sandbox)
+	release = s.bind(container)
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			exitChannel, err = nil, errors.New(fmt.Sprintf("panic: %v", recovered))
+		}
+		if exitChannel == nil {
+			release()
+		}
+	}()
+	result, err := s.result(NewArgument(p.dsl).Evaluate(container))
+	if err != nil {
+		return nil, release, err
+	}
+	exitChannel, _ = result.(chan int)
+	return exitChannel, release, nil
+}
+
+// reportWorkerExit tells the supervisor that the worker behind exitChannel
+// stopped on its own, so the restart policy of its process applies.
+func reportWorkerExit(container map[string]interface{}, exitChannel chan int, err error) {
+	if id, ok := container["processId"].(string); ok {
+		processSupervisor.exited(id, exitChannel, err)
+	}
+}
+
+func exitMessage(err error) string {
+	if err != nil {
+		return fmt.Sprintf("process crashed: %v", err)
+	}
+	return "process exited"
+}
+
+// finish records that the process ended and reports whether its restart
+// policy asks for another run.
+func (p *process) finish(err error) bool {
+	p.stoppedAt = time.Now()
+	p.exitChannel = nil
+	if err != nil {
+		p.status = "crashed"
+		p.err = err.Error()
+	} else {
+		p.status = "stopped"
+		p.err = ""
+	}
+	if p.policy == "always" || (p.policy == "on-failure" && p.status == "crashed") {
+		return p.maxRestarts == 0 || p.restarts < p.maxRestarts
+	}
+	return false
+}
+
+func (s *supervisor) run(p *process) bool {
+	s.mutex.Lock()
+	select {
+	case <-p.stop:
+		s.mutex.Unlock()
+		return false
+	default:
+	}
+	p.status = "starting"
+	p.startedAt = time.Now()
+	p.exited = map[chan int]error{}
+	s.mutex.Unlock()
+	p.log.write("supervisor", "process starting")
+	exitChannel, release, err := p.evaluate()
+	s.mutex.Lock()
+	select {
+	case <-p.stop:
+		s.mutex.Unlock()
+		release()
+		if exitChannel != nil {
+			go stopExitChannel(exitChannel)
+		}
+		return false
+	default:
+	}
+	exitErr, exited := p.exited[exitChannel]
+	p.exited = nil
+	message := ""
+	restart := false
+	p.stoppedAt = time.Time{}
+	switch {
+	case err != nil:
+		restart = p.finish(err)
+		message = exitMessage(err)
+	case exitChannel == nil:
+		restart = p.finish(nil)
+		message = "no channel returned."
+	case exited:
+		release()
+		restart = p.finish(exitErr)
+		message = exitMessage(exitErr)
+	default:
+		// workers report their own exit through reportWorkerExit; errors they
+		// only log while running are not reflected in status.
+		p.status = "running"
+		p.err = ""
+		p.exitChannel = exitChannel
+		p.release = release
+		message = "process running"
+	}
+	s.mutex.Unlock()
+	p.logf("%s", message)
+	return restart
+}
+
+func (s *supervisor) exited(id string, exitChannel chan int, err error) {
+	s.mutex.Lock()
+	p, ok := s.processes[id]
+	if !ok || exitChannel == nil {
+		s.mutex.Unlock()
+		return
+	}
+	if p.exited != nil {
+		p.exited[exitChannel] = err
+		s.mutex.Unlock()
+		return
+	}
+	if p.exitChannel != exitChannel {
+		s.mutex.Unlock()
+		return
+	}
+	release := p.release
+	p.release = nil
+	restart := p.finish(err)
+	s.mutex.Unlock()
+	release()
+	p.logf("%s", exitMessage(err))
+	if restart {
+		go s.restart(p)
+	}
+}
+
+func (s *supervisor) start(p *process) {
+	if s.run(p) {
+		go s.restart(p)
+	}
+}
+
+func (s *supervisor) restart(p *process) {
+	backoff := p.backoff
+	for {
+		select {
+		case <-p.stop:
+			return
+		case <-time.After(backoff):
+		}
+		s.mutex.Lock()
+		p.restarts++
+		s.mutex.Unlock()
+		if !s.run(p) {
+			return
+		}
+		backoff *= 2
+		if backoff > maxRestartBackoff {
+			backoff = maxRestartBackoff
+		}
+	}
+}
+
+func stopExitChannel(exitChannel chan int) {
+	close(exitChannel)
+}
+
+// halt stops p and returns the exit channel the caller closes after releasing
+// the supervisor lock.
+func (p *process) halt() chan int {
+	close(p.stop)
+	p.cancel()
+	if p.release != nil {
+		p.release()
+		p.release = nil
+	}
+	exitChannel := p.exitChannel
+	p.exitChannel = nil
+	return exitChannel
+}
+
+func (s *supervisor) kill(id string) error {
+	s.mutex.Lock()
+	p, ok := s.processes[id]
+	if !ok {
+		s.mutex.Unlock()
+		return errors.New("channel not found")
+	}
+	delete(s.processes, id)
+	exitChannel := p.halt()
+	s.mutex.Unlock()
+	if exitChannel != nil {
+		stopExitChannel(exitChannel)
+	}
+	return nil
+}
+
+// replace registers p unless a process with the same id is still starting or
+// running. A stopped or crashed one, even with a restart pending, is halted.
+func (s *supervisor) replace(p *process) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if previous, ok := s.processes[p.id]; ok {
+		if previous.status == "starting" || previous.status == "running" {
+			return errors.New(fmt.Sprintf("process already running: %v", p.id))
+		}
+		previous.halt()
+	}
+	s.processes[p.id] = p
+	return nil
+}
+
+func (s *supervisor) records() []interface{} {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	ids := []string{}
+	for id := range s.processes {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	result := []interface{}{}
+	for _, id := range ids {
+		p := s.processes[id]
+		record := map[string]interface{}{
+			"id":        p.id,
+			"status":    p.status,
+			"policy":    p.policy,
+			"restarts":  p.restarts,
+			"error":     nil,
+			"startedAt": int(p.startedAt.UnixNano() / int64(time.Millisecond)),
+			"stoppedAt": nil,
+		}
+		if p.err != "" {
+			record["error"] = p.err
+		}
+		if !p.stoppedAt.IsZero() {
+			record["stoppedAt"] = int(p.stoppedAt.UnixNano() / int64(time.Millisecond))
+		}
+		result = append(result, record)
+	}
+	return result
+}
+
+func processOptions(container map[string]interface{}, args []Argument, p *process) error {
+	if len(args) < 3 {
+		return nil
+	}
+	evaluated, err := args[2].Evaluate(container)
+	if err != nil {
+		return err
+	}
+	options, ok := toStringKeyMap(evaluated)
+	if !ok {
+		return errors.New(fmt.Sprintf("processStart options must be map. %v", evaluated))
+	}
+	if policy, ok := options["restart"]; ok {
+		switch policy {
+		case "never", "on-failure", "always":
+			p.policy = policy.(string)
+		default:
+			return errors.New(fmt.Sprintf("processStart restart must be never, on-failure or always. %v", policy))
+		}
+	}
+	if backoff, ok := options["backoff"]; ok {
+		p.backoff, err = toDuration(backoff)
+		if err != nil {
+			return err
+		}
+	}
+	if maxRestarts, ok := options["maxRestarts"]; ok {
+		p.maxRestarts, err = toInt(maxRestarts)
+		if err != nil {
+			return err
+		}
+	}
+	if logLines, ok := options["logLines"]; ok {
+		p.log.capacity, err = toInt(logLines)
+		if err != nil {
+			return err
+		}
+		if p.log.capacity <= 0 {
+			return errors.New(fmt.Sprintf("processStart logLines must be positive. %v", logLines))
+		}
+	}
+	if profile, ok := options["profile"]; ok && profile != nil {
+		p.profile, err = resolveSandboxProfile(profile)
+		if err != nil {
+			return err
+		}
+	}
+	if logChannel, ok := options["logChannel"]; ok && logChannel != nil {
+		channelName, ok := logChannel.(string)
+		if !ok {
+			return errors.New(fmt.Sprintf("processStart logChannel must be string. %v", logChannel))
+		}
+		p.log.channelName = channelName
+	}
+	return nil
+}
+
+func init() {
+	DslFunctions["processStart"] = func(container map[string]interface{}, args ...Argument) (interface{}, error) {
+		processId, err := args[0].Evaluate(container)
+		if err != nil {
+			return nil, err
+		}
+		typedProcessId, ok := processId.(string)
+		if !ok {
+			return nil, errors.New(fmt.Sprintf("processStart process id must be string. %v", processId))
+		}
+		fmt.Println("process start", typedProcessId, args[1])
+		dsl, err := args[1].Evaluate(container)
+		if err != nil {
+			return nil, err
+		}
+		p := &process{
+			id:      typedProcessId,
+			dsl:     dsl,
+			policy:  "never",
+			backoff: time.Second,
+			stop:    make(chan struct{}),
+			log:     &processLog{capacity: 200},
+			sandbox: containerSandbox(container),
+		}
+		p.ctx, p.cancel = context.WithCancel(context.Background())
+		if err := processOptions(container, args, p); err != nil {
+			p.cancel()
+			return nil, err
+		}
+		if err := processSupervisor.replace(p); err != nil {
+			p.cancel()
+			return nil, err
+		}
+		processSupervisor.start(p)
+		return nil, nil
+	}
+
+	DslFunctions["processKill"] = func(container map[string]interface{}, args ...Argument) (interface{}, error) {
+		processId, err := args[0].Evaluate(container)
+		if err != nil {
+			return nil, err
+		}
+		if processId == nil {
+			return nil, nil
+		}
+		typedProcessId, ok := processId.(string)
+		if !ok {
+			return nil, errors.New(fmt.Sprintf("processKill process id must be string. %v", processId))
+		}
+		return nil, processSupervisor.kill(typedProcessId)
+	}
+
+	DslFunctions["processes"] = func(container map[string]interface{}, args ...Argument) (interface{}, error) {
+		return processSupervisor.records(), nil
+	}
+
+	DslFunctions["processLogs"] = func(container map[string]interface{}, args ...Argument) (interface{}, error) {
+		evaluated, err := evaluateAll(args, container)
+		if err != nil {
+			return nil, err
+		}
+		processId, ok := evaluated[0].(string)
+		if !ok {
+			return nil, errors.New(fmt.Sprintf("processLogs process id must be string. %v", evaluated[0]))
+		}
+		n := 0
+		if len(evaluated) > 1 && evaluated[1] != nil {
+			n, err = toInt(evaluated[1])
+			if err != nil {
+				return nil, err
+			}
+		}
+		output := processSupervisor.logFor(processId)
+		if output == nil {
+			return nil, errors.New(fmt.Sprintf("process not found: %v", processId))
+		}
+		return output.tail(n), nil
+	}
+}
@@ -0,0 +1,112 @@
+package mydslgo
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+func processRecord(id string) map[string]interface{} {
+	for _, record := range processSupervisor.records() {
+		if typed := record.(map[string]interface{}); typed["id"] == id {
+			return typed
+		}
+	}
+	return nil
+}
+
+func TestProcessLogSubscriberDoesNotDeadlock(t *testing.T) {
+	previous, hadPrevious := DslAvailableFunctions["testSleep"]
+	DslAvailableFunctions["testSleep"] = func(milliseconds int) {
+		time.Sleep(time.Duration(milliseconds) * time.Millisecond)
+	}
+	t.Cleanup(func() {
+		if hadPrevious {
+			DslAvailableFunctions["testSleep"] = previous
+		} else {
+			delete(DslAvailableFunctions, "testSleep")
+		}
+	})
+	var parsed interface{}
+	if err := yaml.Unmarshal([]byte(`
+sequence:
+  - $.logs: {subscribe: [processLogDeadlock, {sequence: [{do: [testSleep, 20]}, {processes: []}]}, null, {buffer: 1, policy: block}]}
+  - $.dsl: {parseYaml: "sequence: [{print: [a]}, {print: [b]}, {print: [c]}, {subscribe: [processLogIdle, null]}]"}
+  - processStart: [processLogDeadlock, $.dsl, {logChannel: processLogDeadlock}]
+`), &parsed); err != nil {
+		t.Fatal(err)
+	}
+	container := map[string]interface{}{}
+	done := make(chan error, 1)
+	go func() {
+		_, err := NewArgument(parsed).Evaluate(container)
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("supervisor deadlocked while publishing process logs")
+	}
+	if record := processRecord("processLogDeadlock"); record == nil || record["status"] != "running" {
+		t.Fatalf("process is not running: %v", record)
+	}
+	mustEvaluateYaml(t, container, "processKill: [processLogDeadlock]")
+	close(container["logs"].(chan int))
+	waitFor(t, "log subscriber to stop", func() bool {
+		subscribers, _ := pubsub.subscribers("processLogDeadlock")
+		return len(subscribers) == 0
+	})
+}
+
+func TestProcessRestartsWhenRunningWorkerExits(t *testing.T) {
+	DslFunctions["testExitingWorker"] = func(container map[string]interface{}, args ...Argument) (interface{}, error) {
+		exitChannel := make(chan int)
+		go func() {
+			select {
+			case <-exitChannel:
+			case <-time.After(50 * time.Millisecond):
+				reportWorkerExit(container, exitChannel, errors.New("worker failed"))
+			}
+		}()
+		return exitChannel, nil
+	}
+	t.Cleanup(func() { delete(DslFunctions, "testExitingWorker") })
+	mustEvaluateYaml(t, map[string]interface{}{}, `
+sequence:
+  - $.dsl: {parseYaml: "testExitingWorker: []"}
+  - processStart: [processRestartWorker, $.dsl, {restart: on-failure, backoff: 10ms, maxRestarts: 2}]
+`)
+	t.Cleanup(func() { processSupervisor.kill("processRestartWorker") })
+	waitFor(t, "restarts to run out", func() bool {
+		record := processRecord("processRestartWorker")
+		return record["restarts"] == 2 && record["status"] == "crashed"
+	})
+	if record := processRecord("processRestartWorker"); record["error"] != "worker failed" {
+		t.Fatalf("unexpected record: %v", record)
+	}
+}
+
+func TestProcessStartReplacesOnlyFinishedProcesses(t *testing.T) {
+	container := map[string]interface{}{}
+	mustEvaluateYaml(t, container, "processStart: [processReplace, {sequence: []}]")
+	t.Cleanup(func() { processSupervisor.kill("processReplace") })
+	if record := processRecord("processReplace"); record["status"] != "stopped" {
+		t.Fatalf("unexpected record: %v", record)
+	}
+	mustEvaluateYaml(t, container, `
+sequence:
+  - $.dsl: {parseYaml: "subscribe: [processReplaceIdle, null]"}
+  - processStart: [processReplace, $.dsl]
+`)
+	if record := processRecord("processReplace"); record["status"] != "running" {
+		t.Fatalf("stopped process was not replaced: %v", record)
+	}
+	if _, err := evaluateYaml(t, container, "processStart: [processReplace, {sequence: []}]"); err == nil {
+		t.Fatal("expected running process to be rejected")
+	}
+}
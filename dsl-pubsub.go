@@ -0,0 +1,523 @@
+package mydslgo
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type pubsubMessage struct {
+	channelName   string
+	data          interface{}
+	replyTo       string
+	correlationId string
+}
+
+type subscriber struct {
+	id          int64
+	channelName string
+	matcher     func(string) bool
+	queue       chan pubsubMessage
+	policy      string
+	done        chan struct{}
+	delivered   int64
+	dropped     int64
+}
+
+type broker struct {
+	mutex      sync.RWMutex
+	channels   map[string]map[*subscriber]bool
+	patterns   map[*subscriber]bool
+	retentions map[string]*retention
+	transport  pubsubTransport
+	origin     string
+	nextId     int64
+}
+
+type pubsubTransport interface {
+	Publish(channelName string, payload []byte) error
+	Close() error
+}
+
+type transportEnvelope struct {
+	Origin        string      `json:"origin"`
+	Data          interface{} `json:"data"`
+	ReplyTo       string      `json:"replyTo,omitempty"`
+	CorrelationId string      `json:"correlationId,omitempty"`
+}
+
+const defaultSubscriberBuffer = 64
+
+var pubsub = newBroker()
+
+func newBroker() *broker {
+	return &broker{
+		channels:   map[string]map[*subscriber]bool{},
+		patterns:   map[*subscriber]bool{},
+		retentions: map[string]*retention{},
+		origin:     newRandomId(),
+	}
+}
+
+func (b *broker) ensureChannel(channelName string) bool {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if _, ok := b.channels[channelName]; ok {
+		return false
+	}
+	b.channels[channelName] = map[*subscriber]bool{}
+	return true
+}
+
+func (b *broker) subscribe(channelName string, matcher func(string) bool, capacity int, policy string) (*subscriber, bool) {
+	s := &subscriber{
+		id:          atomic.AddInt64(&b.nextId, 1),
+		channelName: channelName,
+		matcher:     matcher,
+		queue:       make(chan pubsubMessage, capacity),
+		policy:      policy,
+		done:        make(chan struct{}),
+	}
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.replay(s)
+	if matcher != nil {
+		b.patterns[s] = true
+		return s, false
+	}
+	subscribers, ok := b.channels[channelName]
+	if !ok {
+		subscribers = map[*subscriber]bool{}
+		b.channels[channelName] = subscribers
+	}
+	subscribers[s] = true
+	return s, !ok
+}
+
+func (b *broker) replay(s *subscriber) {
+	channelNames := []string{}
+	for channelName := range b.retentions {
+		if (s.matcher == nil && channelName == s.channelName) || (s.matcher != nil && s.matcher(channelName)) {
+			channelNames = append(channelNames, channelName)
+		}
+	}
+	sort.Strings(channelNames)
+	for _, channelName := range channelNames {
+		for _, data := range b.retentions[channelName].values() {
+			select {
+			case s.queue <- pubsubMessage{channelName: channelName, data: data}:
+			default:
+				atomic.AddInt64(&s.dropped, 1)
+			}
+		}
+	}
+}
+
+func (b *broker) unsubscribe(s *subscriber) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if subscribers, ok := b.channels[s.channelName]; ok && s.matcher == nil {
+		delete(subscribers, s)
+	}
+	delete(b.patterns, s)
+	close(s.done)
+}
+
+func (b *broker) subscribers(channelName string) ([]*subscriber, bool) {
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+	return b.matchingSubscribers(channelName)
+}
+
+func (b *broker) matchingSubscribers(channelName string) ([]*subscriber, bool) {
+	subscribers, ok := b.channels[channelName]
+	result := []*subscriber{}
+	for s := range subscribers {
+		result = append(result, s)
+	}
+	for s := range b.patterns {
+		if s.matcher(channelName) {
+			result = append(result, s)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].id < result[j].id })
+	return result, ok
+}
+
+func (b *broker) publish(channelName string, data interface{}) (int, bool) {
+	return b.publishMessage(pubsubMessage{channelName: channelName, data: data})
+}
+
+func (b *broker) publishMessage(message pubsubMessage) (int, bool) {
+	delivered, ok := b.deliver(message)
+	b.mutex.RLock()
+	transport := b.transport
+	b.mutex.RUnlock()
+	if transport != nil {
+		payload, err := json.Marshal(transportEnvelope{
+			Origin:        b.origin,
+			Data:          toJsonCompatible(message.data),
+			ReplyTo:       message.replyTo,
+			CorrelationId: message.correlationId,
+		})
+		if err == nil {
+			err = transport.Publish(message.channelName, payload)
+		}
+		if err != nil {
+			log.Println("pubsub transport publish:", message.channelName, err)
+		}
+	}
+	return delivered, ok
+}
+
+func (b *broker) receive(channelName string, payload []byte) {
+	var envelope transportEnvelope
+	if err := json.Unmarshal(payload, &envelope); err != nil {
+		log.Println("pubsub transport receive:", channelName, err)
+		return
+	}
+	if envelope.Origin == b.origin {
+		return
+	}
+	b.deliver(pubsubMessage{
+		channelName:   channelName,
+		data:          fromJsonNumbers(envelope.Data),
+		replyTo:       envelope.ReplyTo,
+		correlationId: envelope.CorrelationId,
+	})
+}
+
+func (b *broker) setTransport(transport pubsubTransport) {
+	b.mutex.Lock()
+	old := b.transport
+	b.transport = transport
+	b.mutex.Unlock()
+	if old != nil {
+		old.Close()
+	}
+}
+
+func (b *broker) hasTransport() bool {
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+	return b.transport != nil
+}
+
+// deliver retains the message and snapshots subscribers under the read lock,
+// which subscribe's replay excludes, so a new subscriber sees each message
+// exactly once. File I/O for the retention happens after the lock is released.
+func (b *broker) deliver(message pubsubMessage) (int, bool) {
+	b.mutex.RLock()
+	r, retained := b.retentions[message.channelName]
+	if retained {
+		r.add(message.data)
+	}
+	subscribers, ok := b.matchingSubscribers(message.channelName)
+	b.mutex.RUnlock()
+	if retained {
+		r.flush()
+	}
+	delivered := 0
+	for _, s := range subscribers {
+		if s.enqueue(message) {
+			delivered++
+		}
+	}
+	return delivered, ok
+}
+
+func (b *broker) channelNames() []string {
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+	result := []string{}
+	for channelName := range b.channels {
+		result = append(result, channelName)
+	}
+	sort.Strings(result)
+	return result
+}
+
+func (b *broker) stats() []interface{} {
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+	grouped := map[string][]*subscriber{}
+	for channelName, subscribers := range b.channels {
+		grouped[channelName] = []*subscriber{}
+		for s := range subscribers {
+			grouped[channelName] = append(grouped[channelName], s)
+		}
+	}
+	for s := range b.patterns {
+		grouped[s.channelName] = append(grouped[s.channelName], s)
+	}
+	channelNames := []string{}
+	for channelName := range grouped {
+		channelNames = append(channelNames, channelName)
+	}
+	sort.Strings(channelNames)
+	result := []interface{}{}
+	for _, channelName := range channelNames {
+		subscribers := grouped[channelName]
+		sort.Slice(subscribers, func(i, j int) bool { return subscribers[i].id < subscribers[j].id })
+		records := []interface{}{}
+		for _, s := range subscribers {
+			records = append(records, map[string]interface{}{
+				"id":        int(s.id),
+				"policy":    s.policy,
+				"pattern":   s.matcher != nil,
+				"depth":     len(s.queue),
+				"capacity":  cap(s.queue),
+				"delivered": int(atomic.LoadInt64(&s.delivered)),
+				"dropped":   int(atomic.LoadInt64(&s.dropped)),
+			})
+		}
+		result = append(result, map[string]interface{}{"channelName": channelName, "subscribers": records})
+	}
+	return result
+}
+
+func matchTopicSegments(patternSegments []string, topicSegments []string) bool {
+	if len(patternSegments) == 0 {
+		return len(topicSegments) == 0
+	}
+	switch patternSegments[0] {
+	case "#":
+		for index := 0; index <= len(topicSegments); index++ {
+			if matchTopicSegments(patternSegments[1:], topicSegments[index:]) {
+				return true
+			}
+		}
+		return false
+	case "*":
+		return len(topicSegments) > 0 && matchTopicSegments(patternSegments[1:], topicSegments[1:])
+	}
+	return len(topicSegments) > 0 && patternSegments[0] == topicSegments[0] && matchTopicSegments(patternSegments[1:], topicSegments[1:])
+}
+
+func topicMatcher(subscription interface{}) (string, func(string) bool, error) {
+	switch typed := subscription.(type) {
+	case *regexp.Regexp:
+		return typed.String(), typed.MatchString, nil
+	case string:
+		patternSegments := strings.Split(typed, ".")
+		for _, segment := range patternSegments {
+			if segment == "*" || segment == "#" {
+				return typed, func(topic string) bool {
+					return matchTopicSegments(patternSegments, strings.Split(topic, "."))
+				}, nil
+			}
+		}
+		return typed, nil, nil
+	}
+	return "", nil, errors.New(fmt.Sprintf("subscribe channel name must be string or regexp. %v", subscription))
+}
+
+func (s *subscriber) enqueue(message pubsubMessage) bool {
+	if s.policy == "block" {
+		select {
+		case s.queue <- message:
+			return true
+		case <-s.done:
+			return false
+		}
+	}
+	select {
+	case s.queue <- message:
+		return true
+	case <-s.done:
+		return false
+	default:
+		atomic.AddInt64(&s.dropped, 1)
+		return false
+	}
+}
+
+func notifyChannelList(channelName string) {
+	if channelName != "channelList" {
+		pubsub.publish("channelList", map[string]interface{}{"channelList": nil})
+	}
+}
+
+func subscribeOptions(container map[string]interface{}, args []Argument) (int, string, error) {
+	capacity := defaultSubscriberBuffer
+	policy := "drop"
+	if len(args) < 4 {
+		return capacity, policy, nil
+	}
+	evaluated, err := args[3].Evaluate(container)
+	if err != nil {
+		return 0, "", err
+	}
+	options, ok := toStringKeyMap(evaluated)
+	if !ok {
+		return 0, "", errors.New(fmt.Sprintf("subscribe options must be map. %v", evaluated))
+	}
+	if buffer, ok := options["buffer"]; ok {
+		capacity, err = toInt(buffer)
+		if err != nil || capacity < 1 {
+			return 0, "", errors.New(fmt.Sprintf("subscribe buffer must be positive int. %v", buffer))
+		}
+	}
+	if rawPolicy, ok := options["policy"]; ok {
+		switch rawPolicy {
+		case "drop", "block":
+			policy = rawPolicy.(string)
+		default:
+			return 0, "", errors.New(fmt.Sprintf("subscribe policy must be drop or block. %v", rawPolicy))
+		}
+	}
+	return capacity, policy, nil
+}
+
+func init() {
+	DslFunctions["subscribe"] = func(container map[string]interface{}, args ...Argument) (interface{}, error) {
+		exitChannel := make(chan int)
+		evaluated, err := args[0].Evaluate(container)
+		if err != nil {
+			return nil, err
+		}
+		channelName, matcher, err := topicMatcher(evaluated)
+		if err != nil {
+			return nil, err
+		}
+		capacity, policy, err := subscribeOptions(container, args)
+		if err != nil {
+			return nil, err
+		}
+		s, created := pubsub.subscribe(channelName, matcher, capacity, policy)
+		inherited := inheritedValues(container)
+		go func() {
+			for {
+				select {
+				case message := <-s.queue:
+					newContainer := map[string]interface{}{"subscribe": message.data, "channelName": channelName, "topic": message.channelName}
+					if message.replyTo != "" {
+						newContainer["replyTo"] = message.replyTo
+						newContainer["correlationId"] = message.correlationId
+					}
+					for key, value := range inherited {
+						newContainer[key] = value
+					}
+					if len(args) > 2 && args[2].rawArg != nil {
+						for _, key := range args[2].rawArg.([]interface{}) {
+							newContainer[key.(string)] = container[key.(string)]
+						}
+					}
+					atomic.AddInt64(&s.delivered, 1)
+					args[1].Evaluate(newContainer)
+				case <-exitChannel:
+					pubsub.unsubscribe(s)
+					fmt.Println("channel closed", channelName)
+					return
+				}
+			}
+		}()
+		if created {
+			notifyChannelList(channelName)
+		}
+		fmt.Println("add subscribe channel", channelName)
+		return exitChannel, nil
+	}
+
+	DslFunctions["publish"] = func(container map[string]interface{}, args ...Argument) (interface{}, error) {
+		channelName, err := args[0].Evaluate(container)
+		if err != nil {
+			return nil, err
+		}
+		typedChannelName, ok := channelName.(string)
+		if !ok {
+			return nil, errors.New(fmt.Sprintf("publish channel name must be string. %v", channelName))
+		}
+		evaluated, err := args[1].Evaluate(container)
+		if err != nil {
+			return nil, err
+		}
+		if delivered, ok := pubsub.publish(typedChannelName, evaluated); !ok {
+			if delivered == 0 {
+				fmt.Println(fmt.Sprintf("channel: %v has no subscribers.", typedChannelName))
+			}
+			if pubsub.ensureChannel(typedChannelName) {
+				notifyChannelList(typedChannelName)
+			}
+		}
+		return nil, nil
+	}
+
+	DslFunctions["requestReply"] = func(container map[string]interface{}, args ...Argument) (interface{}, error) {
+		channelName, err := args[0].Evaluate(container)
+		if err != nil {
+			return nil, err
+		}
+		typedChannelName, ok := channelName.(string)
+		if !ok {
+			return nil, errors.New(fmt.Sprintf("requestReply channel name must be string. %v", channelName))
+		}
+		evaluated, err := args[1].Evaluate(container)
+		if err != nil {
+			return nil, err
+		}
+		timeout := 5 * time.Second
+		if len(args) > 2 {
+			rawTimeout, err := args[2].Evaluate(container)
+			if err != nil {
+				return nil, err
+			}
+			timeout, err = toDuration(rawTimeout)
+			if err != nil {
+				return nil, err
+			}
+		}
+		correlationId := newRandomId()
+		replyTo := "reply." + correlationId
+		s, _ := pubsub.subscribe(replyTo, func(topic string) bool { return topic == replyTo }, 1, "drop")
+		defer pubsub.unsubscribe(s)
+		delivered, _ := pubsub.publishMessage(pubsubMessage{channelName: typedChannelName, data: evaluated, replyTo: replyTo, correlationId: correlationId})
+		if delivered == 0 && !pubsub.hasTransport() {
+			return nil, errors.New(fmt.Sprintf("requestReply: channel %v has no subscribers.", typedChannelName))
+		}
+		ctx := containerContext(container)
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		for {
+			select {
+			case message := <-s.queue:
+				if message.correlationId == correlationId {
+					return message.data, nil
+				}
+			case <-timer.C:
+				return nil, errors.New(fmt.Sprintf("requestReply: no reply from %v within %v.", typedChannelName, timeout))
+			case <-ctx.Done():
+				return nil, errors.New(fmt.Sprintf("requestReply: cancelled waiting for %v: %v", typedChannelName, ctx.Err()))
+			}
+		}
+	}
+
+	DslFunctions["reply"] = func(container map[string]interface{}, args ...Argument) (interface{}, error) {
+		replyTo, ok := container["replyTo"].(string)
+		if !ok {
+			return nil, errors.New("reply must be called inside subscribe body handling requestReply.")
+		}
+		evaluated, err := args[0].Evaluate(container)
+		if err != nil {
+			return nil, err
+		}
+		correlationId, _ := container["correlationId"].(string)
+		pubsub.publishMessage(pubsubMessage{channelName: replyTo, data: evaluated, correlationId: correlationId})
+		return nil, nil
+	}
+
+	DslFunctions["channelList"] = func(container map[string]interface{}, args ...Argument) (interface{}, error) {
+		return pubsub.channelNames(), nil
+	}
+
+	DslFunctions["pubsubStats"] = func(container map[string]interface{}, args ...Argument) (interface{}, error) {
+		return pubsub.stats(), nil
+	}
+}
@@ -0,0 +1,24 @@
+package mydslgo
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRequestReplyStopsOnCancelledContext(t *testing.T) {
+	container := map[string]interface{}{}
+	mustEvaluateYaml(t, container, "$.silent: {subscribe: [requestReplySilent, null]}")
+	defer close(container["silent"].(chan int))
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	started := time.Now()
+	_, err := evaluateYaml(t, map[string]interface{}{"context": ctx}, "requestReply: [requestReplySilent, ping, 10]")
+	if err == nil || !strings.Contains(err.Error(), "cancelled") {
+		t.Fatalf("expected cancellation error, got %v", err)
+	}
+	if elapsed := time.Since(started); elapsed > time.Second {
+		t.Fatalf("requestReply ignored the context for %v", elapsed)
+	}
+}
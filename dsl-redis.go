@@ -0,0 +1,327 @@
+package mydslgo
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type redisTransport struct {
+	address   string
+	password  string
+	prefix    string
+	timeout   time.Duration
+	mutex     sync.Mutex
+	conn      net.Conn
+	subConn   net.Conn
+	queue     chan redisPublish
+	closed    chan struct{}
+	onMessage func(channelName string, payload []byte)
+}
+
+type redisPublish struct {
+	channelName string
+	payload     []byte
+}
+
+const defaultRedisTimeout = 5 * time.Second
+const redisPublishQueue = 1024
+
+func writeRedisCommand(w io.Writer, args ...string) error {
+	command := "*" + strconv.Itoa(len(args)) + "\r\n"
+	for _, arg := range args {
+		command += "$" + strconv.Itoa(len(arg)) + "\r\n" + arg + "\r\n"
+	}
+	_, err := io.WriteString(w, command)
+	return err
+}
+
+func readRedisLine(r *bufio.Reader) (string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(line, "\r\n"), nil
+}
+
+func readRedisReply(r *bufio.Reader) (interface{}, error) {
+	line, err := readRedisLine(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(line) == 0 {
+		return nil, errors.New("redis: empty reply.")
+	}
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return nil, errors.New("redis: " + line[1:])
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		size, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, err
+		}
+		if size < 0 {
+			return nil, nil
+		}
+		b := make([]byte, size+2)
+		if _, err := io.ReadFull(r, b); err != nil {
+			return nil, err
+		}
+		return string(b[:size]), nil
+	case '*':
+		size, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, err
+		}
+		if size < 0 {
+			return nil, nil
+		}
+		items := make([]interface{}, size)
+		for index := range items {
+			items[index], err = readRedisReply(r)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return items, nil
+	}
+	return nil, errors.New(fmt.Sprintf("redis: unknown reply type. %v", line))
+}
+
+func redisRoundTrip(conn net.Conn, reader *bufio.Reader, timeout time.Duration, args ...string) (interface{}, error) {
+	if err := conn.SetDeadline(time.Now().Add(timeout)); err != nil {
+		return nil, err
+	}
+	if err := writeRedisCommand(conn, args...); err != nil {
+		return nil, err
+	}
+	return readRedisReply(reader)
+}
+
+func dialRedis(address string, password string, timeout time.Duration) (net.Conn, *bufio.Reader, error) {
+	conn, err := net.DialTimeout("tcp", address, timeout)
+	if err != nil {
+		return nil, nil, err
+	}
+	reader := bufio.NewReader(conn)
+	if password != "" {
+		if _, err := redisRoundTrip(conn, reader, timeout, "AUTH", password); err != nil {
+			conn.Close()
+			return nil, nil, err
+		}
+	}
+	return conn, reader, nil
+}
+
+func newRedisTransport(address string, password string, prefix string, timeout time.Duration, onMessage func(string, []byte)) (*redisTransport, error) {
+	t := &redisTransport{
+		address:   address,
+		password:  password,
+		prefix:    prefix,
+		timeout:   timeout,
+		queue:     make(chan redisPublish, redisPublishQueue),
+		closed:    make(chan struct{}),
+		onMessage: onMessage,
+	}
+	conn, reader, err := t.dial(&t.conn)
+	if err != nil {
+		return nil, err
+	}
+	subConn, subReader, err := t.subscribeConn()
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	go t.publishLoop(conn, reader)
+	go t.listen(subConn, subReader)
+	return t, nil
+}
+
+// dial stores the new connection in target so Close can reach it, and closes
+// it instead when the transport was closed while dialing.
+func (t *redisTransport) dial(target *net.Conn) (net.Conn, *bufio.Reader, error) {
+	conn, reader, err := dialRedis(t.address, t.password, t.timeout)
+	if err != nil {
+		return nil, nil, err
+	}
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	select {
+	case <-t.closed:
+		conn.Close()
+		return nil, nil, errors.New("redis transport is closed.")
+	default:
+	}
+	*target = conn
+	return conn, reader, nil
+}
+
+func (t *redisTransport) subscribeConn() (net.Conn, *bufio.Reader, error) {
+	conn, reader, err := t.dial(&t.subConn)
+	if err != nil {
+		return nil, nil, err
+	}
+	if _, err := redisRoundTrip(conn, reader, t.timeout, "PSUBSCRIBE", t.prefix+"*"); err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+	if err := conn.SetDeadline(time.Time{}); err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+	return conn, reader, nil
+}
+
+func (t *redisTransport) listen(conn net.Conn, reader *bufio.Reader) {
+	backoff := 100 * time.Millisecond
+	for {
+		for {
+			reply, err := readRedisReply(reader)
+			if err != nil {
+				break
+			}
+			backoff = 100 * time.Millisecond
+			items, ok := reply.([]interface{})
+			if !ok || len(items) != 4 || items[0] != "pmessage" {
+				continue
+			}
+			channelName, _ := items[2].(string)
+			payload, _ := items[3].(string)
+			t.onMessage(strings.TrimPrefix(channelName, t.prefix), []byte(payload))
+		}
+		conn.Close()
+		for {
+			select {
+			case <-t.closed:
+				return
+			case <-time.After(backoff):
+			}
+			var err error
+			conn, reader, err = t.subscribeConn()
+			if err == nil {
+				break
+			}
+			log.Println("redis transport reconnect:", err)
+			if backoff < 10*time.Second {
+				backoff *= 2
+			}
+		}
+	}
+}
+
+func (t *redisTransport) publishLoop(conn net.Conn, reader *bufio.Reader) {
+	for {
+		select {
+		case <-t.closed:
+			return
+		case message := <-t.queue:
+			var err error
+			for attempt := 0; attempt < 2; attempt++ {
+				if conn == nil {
+					conn, reader, err = t.dial(&t.conn)
+					if err != nil {
+						break
+					}
+				}
+				_, err = redisRoundTrip(conn, reader, t.timeout, "PUBLISH", t.prefix+message.channelName, string(message.payload))
+				if err == nil {
+					break
+				}
+				conn.Close()
+				conn = nil
+			}
+			if err != nil {
+				log.Println("redis transport publish:", message.channelName, err)
+			}
+		}
+	}
+}
+
+func (t *redisTransport) Publish(channelName string, payload []byte) error {
+	select {
+	case <-t.closed:
+		return errors.New("redis transport is closed.")
+	default:
+	}
+	select {
+	case t.queue <- redisPublish{channelName: channelName, payload: payload}:
+		return nil
+	default:
+		return errors.New("redis transport queue is full.")
+	}
+}
+
+func (t *redisTransport) Close() error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	select {
+	case <-t.closed:
+		return nil
+	default:
+	}
+	close(t.closed)
+	if t.subConn != nil {
+		t.subConn.Close()
+	}
+	if t.conn != nil {
+		return t.conn.Close()
+	}
+	return nil
+}
+
+func init() {
+	DslFunctions["pubsubTransport"] = func(container map[string]interface{}, args ...Argument) (interface{}, error) {
+		evaluated, err := evaluateAll(args, container)
+		if err != nil {
+			return nil, err
+		}
+		if evaluated[0] == nil {
+			pubsub.setTransport(nil)
+			return nil, nil
+		}
+		if evaluated[0] != "redis" {
+			return nil, errors.New(fmt.Sprintf("pubsubTransport kind must be redis. %v", evaluated[0]))
+		}
+		options := map[string]interface{}{}
+		if len(evaluated) > 1 {
+			typedOptions, ok := toStringKeyMap(evaluated[1])
+			if !ok {
+				return nil, errors.New(fmt.Sprintf("pubsubTransport options must be map. %v", evaluated[1]))
+			}
+			options = typedOptions
+		}
+		address := "127.0.0.1:6379"
+		if rawAddress, ok := options["address"].(string); ok {
+			address = rawAddress
+		}
+		password, _ := options["password"].(string)
+		prefix := "mydsl:"
+		if rawPrefix, ok := options["prefix"].(string); ok {
+			prefix = rawPrefix
+		}
+		timeout := defaultRedisTimeout
+		if rawTimeout, ok := options["timeout"]; ok {
+			timeout, err = toDuration(rawTimeout)
+			if err != nil {
+				return nil, err
+			}
+		}
+		transport, err := newRedisTransport(address, password, prefix, timeout, pubsub.receive)
+		if err != nil {
+			return nil, err
+		}
+		pubsub.setTransport(transport)
+		return nil, nil
+	}
+}
@@ -0,0 +1,270 @@
+package mydslgo
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"net"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type fakeRedisServer struct {
+	listener    net.Listener
+	password    string
+	mutex       sync.Mutex
+	subscribers map[net.Conn]string
+	stall       bool
+}
+
+func newFakeRedisServer(t *testing.T, password string) *fakeRedisServer {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &fakeRedisServer{listener: listener, password: password, subscribers: map[net.Conn]string{}}
+	go server.serve()
+	t.Cleanup(func() { listener.Close() })
+	return server
+}
+
+func (f *fakeRedisServer) serve() {
+	for {
+		conn, err := f.listener.Accept()
+		if err != nil {
+			return
+		}
+		go f.handle(conn)
+	}
+}
+
+func (f *fakeRedisServer) handle(conn net.Conn) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	authenticated := f.password == ""
+	for {
+		reply, err := readRedisReply(reader)
+		if err != nil {
+			f.mutex.Lock()
+			delete(f.subscribers, conn)
+			f.mutex.Unlock()
+			return
+		}
+		args := reply.([]interface{})
+		command := strings.ToUpper(args[0].(string))
+		f.mutex.Lock()
+		switch {
+		case command == "AUTH":
+			authenticated = args[1] == f.password
+			if authenticated {
+				fmt.Fprint(conn, "+OK\r\n")
+			} else {
+				fmt.Fprint(conn, "-ERR invalid password\r\n")
+			}
+		case !authenticated:
+			fmt.Fprint(conn, "-NOAUTH Authentication required.\r\n")
+		case command == "PSUBSCRIBE":
+			pattern := args[1].(string)
+			f.subscribers[conn] = pattern
+			fmt.Fprintf(conn, "*3\r\n$10\r\npsubscribe\r\n$%d\r\n%s\r\n:1\r\n", len(pattern), pattern)
+		case command == "PUBLISH" && f.stall:
+		case command == "PUBLISH":
+			channelName, payload := args[1].(string), args[2].(string)
+			delivered := 0
+			for subscriber, pattern := range f.subscribers {
+				if strings.HasPrefix(channelName, strings.TrimSuffix(pattern, "*")) {
+					writeRedisCommand(subscriber, "pmessage", pattern, channelName, payload)
+					delivered++
+				}
+			}
+			fmt.Fprintf(conn, ":%d\r\n", delivered)
+		default:
+			fmt.Fprintf(conn, "-ERR unknown command %v\r\n", command)
+		}
+		f.mutex.Unlock()
+	}
+}
+
+func (f *fakeRedisServer) subscriberCount() int {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return len(f.subscribers)
+}
+
+func (f *fakeRedisServer) setStall(stall bool) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.stall = stall
+}
+
+func (f *fakeRedisServer) dropSubscribers() {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	for subscriber := range f.subscribers {
+		subscriber.Close()
+		delete(f.subscribers, subscriber)
+	}
+}
+
+func waitFor(t *testing.T, description string, condition func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(3 * time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %v", description)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func receiveMessage(t *testing.T, s *subscriber) pubsubMessage {
+	t.Helper()
+	select {
+	case message := <-s.queue:
+		return message
+	case <-time.After(3 * time.Second):
+		t.Fatal("timed out waiting for message")
+	}
+	return pubsubMessage{}
+}
+
+func TestRedisRespEncoding(t *testing.T) {
+	buffer := &bytes.Buffer{}
+	if err := writeRedisCommand(buffer, "PUBLISH", "orders", "héllo"); err != nil {
+		t.Fatal(err)
+	}
+	if expected := "*3\r\n$7\r\nPUBLISH\r\n$6\r\norders\r\n$6\r\nhéllo\r\n"; buffer.String() != expected {
+		t.Fatalf("unexpected command encoding: %q", buffer.String())
+	}
+	reader := bufio.NewReader(strings.NewReader("+OK\r\n:42\r\n$5\r\nhe\r\no\r\n$-1\r\n*2\r\n$1\r\na\r\n*1\r\n:-1\r\n*-1\r\n-ERR bad thing\r\n?\r\n"))
+	expected := []interface{}{"OK", int64(42), "he\r\no", nil, []interface{}{"a", []interface{}{int64(-1)}}, nil}
+	for index, want := range expected {
+		got, err := readRedisReply(reader)
+		if err != nil {
+			t.Fatalf("reply %v: %v", index, err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("reply %v: got %#v, want %#v", index, got, want)
+		}
+	}
+	if _, err := readRedisReply(reader); err == nil || err.Error() != "redis: ERR bad thing" {
+		t.Fatalf("expected error reply, got %v", err)
+	}
+	if _, err := readRedisReply(reader); err == nil {
+		t.Fatal("expected unknown reply type error")
+	}
+}
+
+func TestRedisTransportAuth(t *testing.T) {
+	server := newFakeRedisServer(t, "secret")
+	if _, err := newRedisTransport(server.listener.Addr().String(), "wrong", "test:", time.Second, func(string, []byte) {}); err == nil {
+		t.Fatal("expected authentication error")
+	}
+	transport, err := newRedisTransport(server.listener.Addr().String(), "secret", "test:", time.Second, func(string, []byte) {})
+	if err != nil {
+		t.Fatal(err)
+	}
+	transport.Close()
+}
+
+func TestRedisTransportAcrossBrokers(t *testing.T) {
+	server := newFakeRedisServer(t, "")
+	address := server.listener.Addr().String()
+	local, remote := newBroker(), newBroker()
+	for _, b := range []*broker{local, remote} {
+		transport, err := newRedisTransport(address, "", "test:", time.Second, b.receive)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b.setTransport(transport)
+		defer b.setTransport(nil)
+	}
+	localSubscriber, _ := local.subscribe("orders", nil, 8, "drop")
+	remoteSubscriber, _ := remote.subscribe("orders", nil, 8, "drop")
+
+	local.publish("orders", map[string]interface{}{"id": 1, "tags": []interface{}{"a"}})
+	expected := map[string]interface{}{"id": 1, "tags": []interface{}{"a"}}
+	if message := receiveMessage(t, remoteSubscriber); !reflect.DeepEqual(message.data, expected) {
+		t.Fatalf("unexpected remote message: %#v", message.data)
+	}
+	if message := receiveMessage(t, localSubscriber); !reflect.DeepEqual(message.data, expected) {
+		t.Fatalf("unexpected local message: %#v", message.data)
+	}
+	remote.publish("orders", "marker")
+	if message := receiveMessage(t, localSubscriber); message.data != "marker" {
+		t.Fatalf("local subscriber received its own message twice: %#v", message.data)
+	}
+	receiveMessage(t, remoteSubscriber)
+
+	server.dropSubscribers()
+	waitFor(t, "transports to resubscribe", func() bool { return server.subscriberCount() == 2 })
+	local.publish("orders", "after reconnect")
+	if message := receiveMessage(t, remoteSubscriber); message.data != "after reconnect" {
+		t.Fatalf("unexpected message after reconnect: %#v", message.data)
+	}
+}
+
+func TestRedisTransportDeliversLocallyFirst(t *testing.T) {
+	server := newFakeRedisServer(t, "")
+	address := server.listener.Addr().String()
+	local, remote := newBroker(), newBroker()
+	for _, b := range []*broker{local, remote} {
+		transport, err := newRedisTransport(address, "", "test:", 200*time.Millisecond, b.receive)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b.setTransport(transport)
+		defer b.setTransport(nil)
+	}
+	localSubscriber, _ := local.subscribe("orders", nil, 8, "drop")
+	remoteSubscriber, _ := remote.subscribe("orders", nil, 8, "drop")
+
+	server.setStall(true)
+	started := time.Now()
+	for index := 0; index < 3; index++ {
+		if delivered, _ := local.publish("orders", index); delivered != 1 {
+			t.Fatalf("expected local delivery, got %v", delivered)
+		}
+	}
+	if elapsed := time.Since(started); elapsed > 100*time.Millisecond {
+		t.Fatalf("publish waited for the transport: %v", elapsed)
+	}
+	for index := 0; index < 3; index++ {
+		if message := receiveMessage(t, localSubscriber); message.data != index {
+			t.Fatalf("unexpected local message: %#v", message.data)
+		}
+	}
+
+	time.Sleep(time.Second)
+	server.setStall(false)
+	local.publish("orders", "after timeout")
+	for {
+		if message := receiveMessage(t, remoteSubscriber); message.data == "after timeout" {
+			break
+		}
+	}
+}
+
+func TestRedisTransportDialAfterClose(t *testing.T) {
+	server := newFakeRedisServer(t, "")
+	transport, err := newRedisTransport(server.listener.Addr().String(), "", "test:", time.Second, func(string, []byte) {})
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "transport to subscribe", func() bool { return server.subscriberCount() == 1 })
+	transport.Close()
+	waitFor(t, "subscription to close", func() bool { return server.subscriberCount() == 0 })
+	if _, _, err := transport.subscribeConn(); err == nil {
+		t.Fatal("expected subscribeConn to fail after Close")
+	}
+	if err := transport.Publish("orders", []byte("{}")); err == nil {
+		t.Fatal("expected Publish to fail after Close")
+	}
+	time.Sleep(300 * time.Millisecond)
+	if count := server.subscriberCount(); count != 0 {
+		t.Fatalf("closed transport resubscribed: %v", count)
+	}
+}
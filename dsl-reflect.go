@@ -0,0 +1,235 @@
+package mydslgo
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+)
+
+var errorType = reflect.TypeOf((*error)(nil)).Elem()
+var durationType = reflect.TypeOf(time.Duration(0))
+
+func fieldName(field reflect.StructField) string {
+	for _, tagName := range []string{"dsl", "json"} {
+		if tag := strings.Split(field.Tag.Get(tagName), ",")[0]; tag != "" {
+			return tag
+		}
+	}
+	return field.Name
+}
+
+func structField(target reflect.Value, key string) (reflect.Value, bool) {
+	targetType := target.Type()
+	for index := 0; index < targetType.NumField(); index++ {
+		field := targetType.Field(index)
+		if field.PkgPath != "" || fieldName(field) == "-" {
+			continue
+		}
+		if fieldName(field) == key || strings.EqualFold(field.Name, key) {
+			return target.Field(index), true
+		}
+	}
+	return reflect.Value{}, false
+}
+
+func convertNumber(value reflect.Value, target reflect.Type) (reflect.Value, error) {
+	result := reflect.New(target).Elem()
+	switch value.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		number := value.Int()
+		switch target.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			if !result.OverflowInt(number) {
+				result.SetInt(number)
+				return result, nil
+			}
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+			if number >= 0 && !result.OverflowUint(uint64(number)) {
+				result.SetUint(uint64(number))
+				return result, nil
+			}
+		case reflect.Float32, reflect.Float64:
+			result.SetFloat(float64(number))
+			return result, nil
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return convertNumber(reflect.ValueOf(int64(value.Uint())), target)
+	case reflect.Float32, reflect.Float64:
+		number := value.Float()
+		switch target.Kind() {
+		case reflect.Float32, reflect.Float64:
+			if !result.OverflowFloat(number) {
+				result.SetFloat(number)
+				return result, nil
+			}
+		default:
+			if number == float64(int64(number)) {
+				return convertNumber(reflect.ValueOf(int64(number)), target)
+			}
+		}
+	}
+	return reflect.Value{}, errors.New(fmt.Sprintf("can not convert %v to %v", value.Interface(), target))
+}
+
+func convertValue(any interface{}, target reflect.Type) (reflect.Value, error) {
+	if any == nil {
+		switch target.Kind() {
+		case reflect.Ptr, reflect.Interface, reflect.Map, reflect.Slice, reflect.Func, reflect.Chan:
+			return reflect.Zero(target), nil
+		}
+		return reflect.Value{}, errors.New(fmt.Sprintf("can not convert null to %v", target))
+	}
+	value := reflect.ValueOf(any)
+	if target == durationType && value.Type() != durationType {
+		duration, err := toDuration(any)
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		return reflect.ValueOf(duration), nil
+	}
+	if value.Type().AssignableTo(target) {
+		return value, nil
+	}
+	switch target.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64:
+		return convertNumber(value, target)
+	case reflect.String:
+		if value.Kind() == reflect.String {
+			return value.Convert(target), nil
+		}
+	case reflect.Bool:
+		if value.Kind() == reflect.Bool {
+			return value.Convert(target), nil
+		}
+	case reflect.Slice, reflect.Array:
+		if value.Kind() == reflect.String && target.Elem().Kind() == reflect.Uint8 && target.Kind() == reflect.Slice {
+			return value.Convert(target), nil
+		}
+		if value.Kind() != reflect.Slice && value.Kind() != reflect.Array {
+			break
+		}
+		var result reflect.Value
+		if target.Kind() == reflect.Slice {
+			result = reflect.MakeSlice(target, value.Len(), value.Len())
+		} else if value.Len() == target.Len() {
+			result = reflect.New(target).Elem()
+		} else {
+			return reflect.Value{}, errors.New(fmt.Sprintf("can not convert %v items to %v", value.Len(), target))
+		}
+		for index := 0; index < value.Len(); index++ {
+			item, err := convertValue(value.Index(index).Interface(), target.Elem())
+			if err != nil {
+				return reflect.Value{}, errors.New(fmt.Sprintf("[%v]: %v", index, err))
+			}
+			result.Index(index).Set(item)
+		}
+		return result, nil
+	case reflect.Map:
+		if value.Kind() != reflect.Map {
+			break
+		}
+		result := reflect.MakeMapWithSize(target, value.Len())
+		for _, key := range value.MapKeys() {
+			convertedKey, err := convertValue(key.Interface(), target.Key())
+			if err != nil {
+				return reflect.Value{}, err
+			}
+			convertedValue, err := convertValue(value.MapIndex(key).Interface(), target.Elem())
+			if err != nil {
+				return reflect.Value{}, errors.New(fmt.Sprintf("%v: %v", key.Interface(), err))
+			}
+			result.SetMapIndex(convertedKey, convertedValue)
+		}
+		return result, nil
+	case reflect.Struct:
+		fields, ok := toStringKeyMap(any)
+		if !ok {
+			break
+		}
+		result := reflect.New(target).Elem()
+		for key, fieldValue := range fields {
+			field, ok := structField(result, key)
+			if !ok {
+				return reflect.Value{}, errors.New(fmt.Sprintf("%v has no field %v", target, key))
+			}
+			converted, err := convertValue(fieldValue, field.Type())
+			if err != nil {
+				return reflect.Value{}, errors.New(fmt.Sprintf("%v.%v: %v", target, key, err))
+			}
+			field.Set(converted)
+		}
+		return result, nil
+	case reflect.Ptr:
+		if value.Kind() == reflect.Ptr {
+			break
+		}
+		converted, err := convertValue(any, target.Elem())
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		pointer := reflect.New(target.Elem())
+		pointer.Elem().Set(converted)
+		return pointer, nil
+	}
+	return reflect.Value{}, errors.New(fmt.Sprintf("can not convert %v (%v) to %v", any, value.Type(), target))
+}
+
+func callArguments(functionType reflect.Type, args []interface{}) ([]reflect.Value, error) {
+	fixed := functionType.NumIn()
+	if functionType.IsVariadic() {
+		fixed--
+		if len(args) < fixed {
+			return nil, errors.New(fmt.Sprintf("expects at least %v arguments, got %v", fixed, len(args)))
+		}
+	} else if len(args) != fixed {
+		return nil, errors.New(fmt.Sprintf("expects %v arguments, got %v", fixed, len(args)))
+	}
+	values := []reflect.Value{}
+	for index, arg := range args {
+		var target reflect.Type
+		if index < fixed {
+			target = functionType.In(index)
+		} else {
+			target = functionType.In(fixed).Elem()
+		}
+		converted, err := convertValue(arg, target)
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("argument %v: %v", index, err))
+		}
+		values = append(values, converted)
+	}
+	return values, nil
+}
+
+func callFunction(function interface{}, args []interface{}) (result interface{}, err error) {
+	functionValue := reflect.ValueOf(function)
+	functionType := functionValue.Type()
+	values, err := callArguments(functionType, args)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("do %v: %v", functionType, err))
+	}
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			result, err = nil, errors.New(fmt.Sprintf("do %v: panic: %v", functionType, recovered))
+		}
+	}()
+	callResult := functionValue.Call(values)
+	numOut := functionType.NumOut()
+	if numOut == 0 || functionType.Out(numOut-1) != errorType {
+		return stripCallResult(callResult), nil
+	}
+	if errValue := callResult[numOut-1]; !errValue.IsNil() {
+		return nil, errValue.Interface().(error)
+	}
+	switch numOut {
+	case 1:
+		return nil, nil
+	case 2:
+		return callResult[0].Interface(), nil
+	}
+	return stripCallResult(callResult[:numOut-1]), nil
+}
@@ -0,0 +1,273 @@
+package mydslgo
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+type retainedMessage struct {
+	Data interface{} `json:"data"`
+	At   time.Time   `json:"at"`
+}
+
+type retention struct {
+	mutex     sync.Mutex
+	fileMutex sync.Mutex
+	limit     int
+	ttl       time.Duration
+	messages  []retainedMessage
+	pending   []retainedMessage
+	path      string
+	file      *os.File
+	logged    int
+}
+
+func newRetention(limit int, ttl time.Duration, path string) (*retention, error) {
+	r := &retention{limit: limit, ttl: ttl, messages: []retainedMessage{}, path: path}
+	if path == "" {
+		return r, nil
+	}
+	if err := r.load(); err != nil {
+		return nil, err
+	}
+	if err := r.compact(r.messages); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *retention) load() error {
+	file, err := os.Open(r.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var message retainedMessage
+		if err := json.Unmarshal(scanner.Bytes(), &message); err != nil {
+			log.Println("retention load:", r.path, err)
+			continue
+		}
+		message.Data = fromJsonNumbers(message.Data)
+		r.messages = append(r.messages, message)
+	}
+	r.trim()
+	return scanner.Err()
+}
+
+func fromJsonNumbers(any interface{}) interface{} {
+	switch value := any.(type) {
+	case float64:
+		if value == float64(int(value)) {
+			return int(value)
+		}
+	case map[string]interface{}:
+		for k, v := range value {
+			value[k] = fromJsonNumbers(v)
+		}
+	case []interface{}:
+		for i, v := range value {
+			value[i] = fromJsonNumbers(v)
+		}
+	}
+	return any
+}
+
+func (r *retention) compact(messages []retainedMessage) error {
+	if r.file != nil {
+		r.file.Close()
+	}
+	file, err := os.OpenFile(r.path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	r.file = file
+	r.logged = 0
+	for _, message := range messages {
+		if err := r.write(message); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *retention) write(message retainedMessage) error {
+	b, err := json.Marshal(retainedMessage{Data: toJsonCompatible(message.Data), At: message.At})
+	if err != nil {
+		return err
+	}
+	if _, err := r.file.Write(append(b, '\n')); err != nil {
+		return err
+	}
+	r.logged++
+	return nil
+}
+
+func (r *retention) trim() {
+	if r.ttl > 0 {
+		deadline := time.Now().Add(-r.ttl)
+		index := 0
+		for index < len(r.messages) && r.messages[index].At.Before(deadline) {
+			index++
+		}
+		r.messages = r.messages[index:]
+	}
+	if len(r.messages) > r.limit {
+		r.messages = r.messages[len(r.messages)-r.limit:]
+	}
+}
+
+func (r *retention) add(data interface{}) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	message := retainedMessage{Data: data, At: time.Now()}
+	r.messages = append(r.messages, message)
+	r.trim()
+	if r.path != "" {
+		r.pending = append(r.pending, message)
+	}
+}
+
+// flush writes the messages added since the last flush. It takes pending and,
+// when the log has grown, a snapshot for compaction in one step so each
+// message reaches the file exactly once and in the order it was added.
+func (r *retention) flush() {
+	r.fileMutex.Lock()
+	defer r.fileMutex.Unlock()
+	r.mutex.Lock()
+	pending := r.pending
+	r.pending = nil
+	var snapshot []retainedMessage
+	if r.logged+len(pending) > r.limit*2 {
+		snapshot = append([]retainedMessage{}, r.messages...)
+	}
+	r.mutex.Unlock()
+	if r.file == nil || len(pending) == 0 {
+		return
+	}
+	var err error
+	if snapshot != nil {
+		err = r.compact(snapshot)
+	} else {
+		for _, message := range pending {
+			if err = r.write(message); err != nil {
+				break
+			}
+		}
+	}
+	if err != nil {
+		log.Println("retention write:", r.path, err)
+	}
+}
+
+func (r *retention) values() []interface{} {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.trim()
+	result := []interface{}{}
+	for _, message := range r.messages {
+		result = append(result, message.Data)
+	}
+	return result
+}
+
+func (r *retention) close() {
+	r.fileMutex.Lock()
+	defer r.fileMutex.Unlock()
+	if r.file != nil {
+		r.file.Close()
+		r.file = nil
+	}
+}
+
+func (b *broker) retain(channelName string, r *retention) {
+	b.mutex.Lock()
+	old, ok := b.retentions[channelName]
+	if r == nil {
+		delete(b.retentions, channelName)
+	} else {
+		b.retentions[channelName] = r
+	}
+	b.mutex.Unlock()
+	if ok {
+		old.close()
+	}
+}
+
+func (b *broker) retained(channelName string) []interface{} {
+	b.mutex.RLock()
+	r, ok := b.retentions[channelName]
+	b.mutex.RUnlock()
+	if ok {
+		return r.values()
+	}
+	return []interface{}{}
+}
+
+func init() {
+	DslFunctions["retain"] = func(container map[string]interface{}, args ...Argument) (interface{}, error) {
+		evaluated, err := evaluateAll(args, container)
+		if err != nil {
+			return nil, err
+		}
+		channelName, ok := evaluated[0].(string)
+		if !ok {
+			return nil, errors.New(fmt.Sprintf("retain channel name must be string. %v", evaluated[0]))
+		}
+		if len(evaluated) < 2 || evaluated[1] == nil {
+			pubsub.retain(channelName, nil)
+			return nil, nil
+		}
+		options, ok := toStringKeyMap(evaluated[1])
+		if !ok {
+			return nil, errors.New(fmt.Sprintf("retain options must be map. %v", evaluated[1]))
+		}
+		limit := 1
+		if rawLimit, ok := options["last"]; ok {
+			limit, err = toInt(rawLimit)
+			if err != nil || limit < 1 {
+				return nil, errors.New(fmt.Sprintf("retain last must be positive int. %v", rawLimit))
+			}
+		}
+		var ttl time.Duration
+		if rawTtl, ok := options["ttl"]; ok {
+			ttl, err = toDuration(rawTtl)
+			if err != nil {
+				return nil, err
+			}
+		}
+		path, _ := options["file"].(string)
+		r, err := newRetention(limit, ttl, path)
+		if err != nil {
+			return nil, err
+		}
+		pubsub.retain(channelName, r)
+		if pubsub.ensureChannel(channelName) {
+			notifyChannelList(channelName)
+		}
+		return nil, nil
+	}
+
+	DslFunctions["retained"] = func(container map[string]interface{}, args ...Argument) (interface{}, error) {
+		evaluated, err := args[0].Evaluate(container)
+		if err != nil {
+			return nil, err
+		}
+		channelName, ok := evaluated.(string)
+		if !ok {
+			return nil, errors.New(fmt.Sprintf("retained channel name must be string. %v", evaluated))
+		}
+		return pubsub.retained(channelName), nil
+	}
+}
@@ -0,0 +1,42 @@
+package mydslgo
+
+import (
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+func TestRetentionConcurrentDeliver(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "retention.log")
+	r, err := newRetention(3, 0, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := newBroker()
+	b.retain("retentionTest", r)
+	t.Cleanup(func() { b.retain("retentionTest", nil) })
+	waitGroup := sync.WaitGroup{}
+	for worker := 0; worker < 8; worker++ {
+		waitGroup.Add(1)
+		go func(worker int) {
+			defer waitGroup.Done()
+			for index := 0; index < 50; index++ {
+				b.publish("retentionTest", worker*100+index)
+			}
+		}(worker)
+	}
+	waitGroup.Wait()
+	expected := b.retained("retentionTest")
+	if len(expected) != 3 {
+		t.Fatalf("unexpected retained values: %v", expected)
+	}
+	reloaded, err := newRetention(3, 0, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reloaded.close()
+	if values := reloaded.values(); !reflect.DeepEqual(values, expected) {
+		t.Fatalf("file %v does not match memory %v", values, expected)
+	}
+}
@@ -0,0 +1,382 @@
+package mydslgo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// maxTime sets a deadline on the container context. Builtins that block
+// (request, requestReply, sql, storeLock) give up when it passes; Go
+// functions called through do run to completion.
+type sandboxProfile struct {
+	allow          map[string]bool
+	deny           map[string]bool
+	allowFunctions map[string]bool
+	denyFunctions  map[string]bool
+	maxSteps       int64
+	maxTime        time.Duration
+	maxMemory      int
+	maxDepth       int
+}
+
+type sandboxDepth int
+
+type sandbox struct {
+	profile   *sandboxProfile
+	parent    *sandbox
+	steps     int64
+	startedAt time.Time
+	mutex     sync.Mutex
+	violation error
+}
+
+var sandboxProfiles = map[string]*sandboxProfile{}
+var sandboxMutex = sync.RWMutex{}
+
+func toNameSet(raw interface{}) map[string]bool {
+	if raw == nil {
+		return nil
+	}
+	names := map[string]bool{}
+	for _, name := range toInterfaceSlice(raw) {
+		names[fmt.Sprint(name)] = true
+	}
+	return names
+}
+
+func parseSandboxProfile(raw interface{}) (*sandboxProfile, error) {
+	spec, ok := toStringKeyMap(raw)
+	if !ok {
+		return nil, errors.New(fmt.Sprintf("sandbox profile must be map. %v", raw))
+	}
+	profile := &sandboxProfile{}
+	for key, value := range spec {
+		var err error
+		switch key {
+		case "allow":
+			profile.allow = toNameSet(value)
+		case "deny":
+			profile.deny = toNameSet(value)
+		case "allowFunctions":
+			profile.allowFunctions = toNameSet(value)
+		case "denyFunctions":
+			profile.denyFunctions = toNameSet(value)
+		case "maxSteps":
+			var maxSteps int
+			maxSteps, err = toInt(value)
+			profile.maxSteps = int64(maxSteps)
+		case "maxTime":
+			profile.maxTime, err = toDuration(value)
+		case "maxMemory":
+			profile.maxMemory, err = toInt(value)
+		case "maxDepth":
+			profile.maxDepth, err = toInt(value)
+		default:
+			return nil, errors.New(fmt.Sprintf("sandbox profile unknown option: %v", key))
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return profile, nil
+}
+
+func resolveSandboxProfile(raw interface{}) (*sandboxProfile, error) {
+	if name, ok := raw.(string); ok {
+		sandboxMutex.RLock()
+		defer sandboxMutex.RUnlock()
+		profile, ok := sandboxProfiles[name]
+		if !ok {
+			return nil, errors.New(fmt.Sprintf("sandbox profile not found: %v", name))
+		}
+		return profile, nil
+	}
+	return parseSandboxProfile(raw)
+}
+
+func newSandbox(profile *sandboxProfile, parent *sandbox) *sandbox {
+	if profile == nil {
+		return parent
+	}
+	return &sandbox{profile: profile, parent: parent, startedAt: time.Now()}
+}
+
+func containerSandbox(container map[string]interface{}) *sandbox {
+	s, _ := container["sandbox"].(*sandbox)
+	return s
+}
+
+func (s *sandbox) deadline() (time.Time, bool) {
+	deadline := time.Time{}
+	for level := s; level != nil; level = level.parent {
+		if level.profile.maxTime <= 0 {
+			continue
+		}
+		levelDeadline := level.startedAt.Add(level.profile.maxTime)
+		if deadline.IsZero() || levelDeadline.Before(deadline) {
+			deadline = levelDeadline
+		}
+	}
+	return deadline, !deadline.IsZero()
+}
+
+func (s *sandbox) bind(container map[string]interface{}) context.CancelFunc {
+	if s == nil {
+		return func() {}
+	}
+	container["sandbox"] = s
+	deadline, ok := s.deadline()
+	if !ok {
+		return func() {}
+	}
+	ctx, cancel := context.WithDeadline(containerContext(container), deadline)
+	container["context"] = ctx
+	return cancel
+}
+
+func (s *sandbox) fail(err error) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.violation == nil {
+		s.violation = err
+	}
+	return err
+}
+
+func (s *sandbox) err() error {
+	for level := s; level != nil; level = level.parent {
+		level.mutex.Lock()
+		violation := level.violation
+		level.mutex.Unlock()
+		if violation != nil {
+			return violation
+		}
+	}
+	return nil
+}
+
+func (s *sandbox) result(result interface{}, err error) (interface{}, error) {
+	if s == nil {
+		return result, err
+	}
+	if violation := s.err(); violation != nil {
+		return nil, violation
+	}
+	if err != nil {
+		if expired := s.expired(); expired != nil {
+			return nil, s.fail(expired)
+		}
+	}
+	return result, err
+}
+
+func (s *sandbox) checkBuiltin(name string) error {
+	for level := s; level != nil; level = level.parent {
+		profile := level.profile
+		if profile.deny[name] || (profile.allow != nil && !profile.allow[name]) {
+			return errors.New(fmt.Sprintf("sandbox: builtin %v is not allowed", name))
+		}
+	}
+	return nil
+}
+
+func (s *sandbox) checkFunction(name string) error {
+	for level := s; level != nil; level = level.parent {
+		profile := level.profile
+		if profile.denyFunctions[name] || (profile.allowFunctions != nil && !profile.allowFunctions[name]) {
+			return errors.New(fmt.Sprintf("sandbox: go function %v is not allowed", name))
+		}
+	}
+	return nil
+}
+
+func (s *sandbox) expired() error {
+	now := time.Now()
+	for level := s; level != nil; level = level.parent {
+		if maxTime := level.profile.maxTime; maxTime > 0 && now.Sub(level.startedAt) >= maxTime {
+			return errors.New(fmt.Sprintf("sandbox: max wall time exceeded (%v)", maxTime))
+		}
+	}
+	return nil
+}
+
+func (s *sandbox) step(depth sandboxDepth) error {
+	if err := s.expired(); err != nil {
+		return err
+	}
+	for level := s; level != nil; level = level.parent {
+		profile := level.profile
+		steps := atomic.AddInt64(&level.steps, 1)
+		if profile.maxSteps > 0 && steps > profile.maxSteps {
+			return errors.New(fmt.Sprintf("sandbox: max steps exceeded (%v)", profile.maxSteps))
+		}
+		if profile.maxDepth > 0 && int(depth) > profile.maxDepth {
+			return errors.New(fmt.Sprintf("sandbox: max recursion depth exceeded (%v)", profile.maxDepth))
+		}
+	}
+	return nil
+}
+
+func (s *sandbox) checkMemory(value interface{}) error {
+	for level := s; level != nil; level = level.parent {
+		limit := level.profile.maxMemory
+		if limit <= 0 {
+			continue
+		}
+		if size := valueSize(value, map[uintptr]bool{}, limit); size > limit {
+			return errors.New(fmt.Sprintf("sandbox: produced value exceeds max memory (%v bytes)", limit))
+		}
+	}
+	return nil
+}
+
+func valueSize(any interface{}, visited map[uintptr]bool, limit int) int {
+	switch value := any.(type) {
+	case nil:
+		return 0
+	case string:
+		return len(value)
+	case []byte:
+		return len(value)
+	}
+	reflected := reflect.ValueOf(any)
+	switch reflected.Kind() {
+	case reflect.Map, reflect.Slice:
+		if reflected.Kind() == reflect.Map || reflected.Len() > 0 {
+			pointer := reflected.Pointer()
+			if visited[pointer] {
+				return 0
+			}
+			visited[pointer] = true
+		}
+		size := 0
+		if reflected.Kind() == reflect.Map {
+			for _, key := range reflected.MapKeys() {
+				size += valueSize(key.Interface(), visited, limit) + valueSize(reflected.MapIndex(key).Interface(), visited, limit)
+				if size > limit {
+					return size
+				}
+			}
+			return size
+		}
+		for index := 0; index < reflected.Len(); index++ {
+			size += valueSize(reflected.Index(index).Interface(), visited, limit)
+			if size > limit {
+				return size
+			}
+		}
+		return size
+	}
+	return 8
+}
+
+func callSandboxed(rawSandbox interface{}, container map[string]interface{}, name string, f func(map[string]interface{}, ...Argument) (interface{}, error), args []Argument) (interface{}, error) {
+	s, ok := rawSandbox.(*sandbox)
+	if !ok {
+		return nil, errors.New("sandbox: container key sandbox is reserved")
+	}
+	if err := s.err(); err != nil {
+		return nil, err
+	}
+	if err := s.checkBuiltin(name); err != nil {
+		return nil, s.fail(err)
+	}
+	depth := sandboxDepth(0)
+	if rawDepth, ok := container["sandboxDepth"]; ok {
+		if depth, ok = rawDepth.(sandboxDepth); !ok {
+			return nil, s.fail(errors.New("sandbox: container key sandboxDepth is reserved"))
+		}
+	}
+	if err := s.step(depth + 1); err != nil {
+		return nil, s.fail(err)
+	}
+	container["sandboxDepth"] = depth + 1
+	result, err := f(container, args...)
+	container["sandboxDepth"] = depth
+	if container["sandbox"] != s {
+		container["sandbox"] = s
+		return nil, s.fail(errors.New("sandbox: container key sandbox is reserved"))
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := s.checkMemory(result); err != nil {
+		return nil, s.fail(err)
+	}
+	return result, nil
+}
+
+// callBuiltin calls the builtin name the way Evaluate does, so sandbox
+// profiles also apply to builtins that other builtins call internally.
+func callBuiltin(container map[string]interface{}, name string, args ...Argument) (interface{}, error) {
+	f, ok := DslFunctions[name]
+	if !ok {
+		return nil, errors.New(fmt.Sprintf("builtin not found: %v", name))
+	}
+	if rawSandbox, ok := container["sandbox"]; ok {
+		return callSandboxed(rawSandbox, container, name, f, args)
+	}
+	return f(container, args...)
+}
+
+func checkGoFunction(container map[string]interface{}, name string) error {
+	if rawSandbox, ok := container["sandbox"]; ok {
+		s, ok := rawSandbox.(*sandbox)
+		if !ok {
+			return errors.New("sandbox: container key sandbox is reserved")
+		}
+		if err := s.checkFunction(name); err != nil {
+			return s.fail(err)
+		}
+	}
+	return nil
+}
+
+func init() {
+	DslFunctions["sandboxProfile"] = func(container map[string]interface{}, args ...Argument) (interface{}, error) {
+		if containerSandbox(container) != nil {
+			return nil, errors.New("sandbox: sandboxProfile can not be called inside a sandbox")
+		}
+		evaluated, err := evaluateAll(args, container)
+		if err != nil {
+			return nil, err
+		}
+		name, ok := evaluated[0].(string)
+		if !ok {
+			return nil, errors.New(fmt.Sprintf("sandboxProfile name must be string. %v", evaluated[0]))
+		}
+		profile, err := parseSandboxProfile(evaluated[1])
+		if err != nil {
+			return nil, err
+		}
+		sandboxMutex.Lock()
+		sandboxProfiles[name] = profile
+		sandboxMutex.Unlock()
+		return nil, nil
+	}
+
+	DslFunctions["sandbox"] = func(container map[string]interface{}, args ...Argument) (interface{}, error) {
+		evaluated, err := args[0].Evaluate(container)
+		if err != nil {
+			return nil, err
+		}
+		profile, err := resolveSandboxProfile(evaluated)
+		if err != nil {
+			return nil, err
+		}
+		child := childScope(container, containerContext(container))
+		s := newSandbox(profile, containerSandbox(container))
+		cancel := s.bind(child)
+		defer cancel()
+		result, err := args[1].Evaluate(child)
+		if child["sandbox"] != s {
+			s.fail(errors.New("sandbox: container key sandbox is reserved"))
+		}
+		return s.result(result, err)
+	}
+}
@@ -0,0 +1,58 @@
+package mydslgo
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi"
+)
+
+func TestSandboxDeniesIndirectBuiltins(t *testing.T) {
+	for _, src := range []string{
+		"sandbox: [{deny: [handler]}, {server: {address: '127.0.0.1:0', routes: [[get, /x, {sendStatus: 200}]]}}]",
+		"sandbox: [{deny: [plus]}, '1 + 2']",
+		"sandbox: [{deny: [compare]}, '1 < 2']",
+		"sandbox: [{deny: [set]}, {$.x: 1}]",
+		"sandbox: [{deny: [get]}, $.x]",
+	} {
+		_, err := evaluateYaml(t, map[string]interface{}{"x": 1}, src)
+		if err == nil || !strings.Contains(err.Error(), "is not allowed") {
+			t.Errorf("%v: expected denied builtin, got %v", src, err)
+		}
+	}
+}
+
+func TestSandboxDeniesRenderFromHandler(t *testing.T) {
+	render := DslFunctions["render"]
+	DslFunctions["render"] = func(container map[string]interface{}, args ...Argument) (interface{}, error) {
+		return callBuiltin(container, "send", NewArgument("rendered"))
+	}
+	t.Cleanup(func() { DslFunctions["render"] = render })
+	container := map[string]interface{}{"router": chi.NewRouter()}
+	mustEvaluateYaml(t, container, "handler: [get, /open, view.html]")
+	mustEvaluateYaml(t, container, "sandbox: [{deny: [render]}, {handler: [get, /denied, view.html]}]")
+	server := httptest.NewServer(container["router"].(*chi.Mux))
+	defer server.Close()
+	if _, body := doTestRequest(t, "GET", server.URL+"/open", "", nil); body != "rendered" {
+		t.Fatalf("unexpected body outside the sandbox: %v", body)
+	}
+	if _, body := doTestRequest(t, "GET", server.URL+"/denied", "", nil); body == "rendered" {
+		t.Fatal("render ran inside the sandbox")
+	}
+}
+
+func TestSandboxMaxTimeInterruptsStoreLock(t *testing.T) {
+	lock := namespaceStore("default").keyLock("sandboxStoreLock")
+	lock <- struct{}{}
+	defer func() { <-lock }()
+	started := time.Now()
+	_, err := evaluateYaml(t, map[string]interface{}{}, "sandbox: [{maxTime: 50ms}, {storeLock: [sandboxStoreLock, null]}]")
+	if err == nil {
+		t.Fatal("expected storeLock to give up at the sandbox deadline")
+	}
+	if elapsed := time.Since(started); elapsed > time.Second {
+		t.Fatalf("storeLock ignored the sandbox deadline for %v", elapsed)
+	}
+}
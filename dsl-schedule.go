@@ -0,0 +1,456 @@
+package mydslgo
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type cronField uint64
+
+type cronSchedule struct {
+	seconds  cronField
+	minutes  cronField
+	hours    cronField
+	days     cronField
+	months   cronField
+	weekdays cronField
+	daysStar bool
+	weekStar bool
+	location *time.Location
+}
+
+type everySchedule struct {
+	interval time.Duration
+}
+
+type schedule interface {
+	next(t time.Time) time.Time
+}
+
+type scheduledJob struct {
+	id         string
+	expression string
+	schedule   schedule
+	location   *time.Location
+	jitter     time.Duration
+	overlap    string
+	body       Argument
+	container  map[string]interface{}
+	running    int
+	runs       int
+	skipped    int
+	lastRun    time.Time
+}
+
+var scheduledJobs = map[string]*scheduledJob{}
+var scheduleMutex = sync.RWMutex{}
+
+var cronMonthNames = map[string]int{"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6, "jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12}
+var cronWeekdayNames = map[string]int{"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6}
+
+var cronDescriptors = map[string]string{
+	"@yearly":   "0 0 0 1 1 *",
+	"@annually": "0 0 0 1 1 *",
+	"@monthly":  "0 0 0 1 * *",
+	"@weekly":   "0 0 0 * * 0",
+	"@daily":    "0 0 0 * * *",
+	"@midnight": "0 0 0 * * *",
+	"@hourly":   "0 0 * * * *",
+}
+
+func (f cronField) has(value int) bool {
+	return f&(1<<uint(value)) != 0
+}
+
+func cronValue(raw string, names map[string]int) (int, error) {
+	if value, ok := names[strings.ToLower(raw)]; ok {
+		return value, nil
+	}
+	return strconv.Atoi(raw)
+}
+
+func parseCronField(field string, min int, max int, names map[string]int) (cronField, error) {
+	var result cronField
+	for _, part := range strings.Split(field, ",") {
+		step := 1
+		if index := strings.Index(part, "/"); index >= 0 {
+			var err error
+			step, err = strconv.Atoi(part[index+1:])
+			if err != nil || step <= 0 {
+				return 0, errors.New(fmt.Sprintf("invalid cron step: %v", part))
+			}
+			part = part[:index]
+		}
+		start, end := min, max
+		if part != "*" && part != "?" {
+			bounds := strings.SplitN(part, "-", 2)
+			var err error
+			start, err = cronValue(bounds[0], names)
+			if err != nil {
+				return 0, errors.New(fmt.Sprintf("invalid cron value: %v", part))
+			}
+			end = start
+			if len(bounds) == 2 {
+				end, err = cronValue(bounds[1], names)
+				if err != nil {
+					return 0, errors.New(fmt.Sprintf("invalid cron value: %v", part))
+				}
+			} else if step > 1 {
+				end = max
+			}
+		}
+		if start < min || end > max || start > end {
+			return 0, errors.New(fmt.Sprintf("cron value out of range %v-%v: %v", min, max, part))
+		}
+		for value := start; value <= end; value += step {
+			result |= 1 << uint(value)
+		}
+	}
+	return result, nil
+}
+
+func parseSchedule(expression string, location *time.Location) (schedule, error) {
+	expression = strings.TrimSpace(expression)
+	if strings.HasPrefix(expression, "@every ") {
+		interval, err := time.ParseDuration(strings.TrimSpace(strings.TrimPrefix(expression, "@every ")))
+		if err != nil {
+			return nil, err
+		}
+		if interval < time.Second {
+			return nil, errors.New(fmt.Sprintf("@every interval must be at least 1s. %v", interval))
+		}
+		return &everySchedule{interval: interval}, nil
+	}
+	if descriptor, ok := cronDescriptors[expression]; ok {
+		expression = descriptor
+	}
+	fields := strings.Fields(expression)
+	if len(fields) == 5 {
+		fields = append([]string{"0"}, fields...)
+	}
+	if len(fields) != 6 {
+		return nil, errors.New(fmt.Sprintf("cron expression must have 5 or 6 fields. %v", expression))
+	}
+	c := &cronSchedule{
+		daysStar: fields[3] == "*" || fields[3] == "?",
+		weekStar: fields[5] == "*" || fields[5] == "?",
+		location: location,
+	}
+	targets := []*cronField{&c.seconds, &c.minutes, &c.hours, &c.days, &c.months, &c.weekdays}
+	ranges := [][2]int{{0, 59}, {0, 59}, {0, 23}, {1, 31}, {1, 12}, {0, 7}}
+	names := []map[string]int{nil, nil, nil, nil, cronMonthNames, cronWeekdayNames}
+	for index, field := range fields {
+		parsed, err := parseCronField(field, ranges[index][0], ranges[index][1], names[index])
+		if err != nil {
+			return nil, err
+		}
+		*targets[index] = parsed
+	}
+	if c.weekdays.has(7) {
+		c.weekdays |= 1
+	}
+	return c, nil
+}
+
+func (c *cronSchedule) dayMatches(t time.Time) bool {
+	day := c.days.has(t.Day())
+	weekday := c.weekdays.has(int(t.Weekday()))
+	if c.daysStar || c.weekStar {
+		return day && weekday
+	}
+	return day || weekday
+}
+
+func nextHour(t time.Time) time.Time {
+	return t.Add(-time.Duration(t.Minute())*time.Minute - time.Duration(t.Second())*time.Second + time.Hour)
+}
+
+// next steps hours in absolute time, so a skipped hour is skipped and a
+// repeated hour matches twice. time.Date can land before t inside a DST gap,
+// so any step that does not move forward falls back to the next hour.
+func (c *cronSchedule) next(t time.Time) time.Time {
+	loc := c.location
+	t = t.In(loc).Truncate(time.Second).Add(time.Second)
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		var next time.Time
+		switch {
+		case !c.months.has(int(t.Month())):
+			next = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, loc)
+		case !c.dayMatches(t):
+			next = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, loc)
+		case !c.hours.has(t.Hour()):
+			next = nextHour(t)
+		case !c.minutes.has(t.Minute()):
+			next = t.Truncate(time.Minute).Add(time.Minute)
+		case !c.seconds.has(t.Second()):
+			next = t.Add(time.Second)
+		default:
+			return t
+		}
+		if !next.After(t) {
+			next = nextHour(t)
+		}
+		t = next
+	}
+	return time.Time{}
+}
+
+func (e *everySchedule) next(t time.Time) time.Time {
+	return t.Truncate(time.Second).Add(e.interval)
+}
+
+func nextRuns(s schedule, location *time.Location, from time.Time, n int) []interface{} {
+	result := []interface{}{}
+	t := from
+	for index := 0; index < n; index++ {
+		t = s.next(t)
+		if t.IsZero() {
+			break
+		}
+		result = append(result, t.In(location).Format(time.RFC3339))
+	}
+	return result
+}
+
+func scheduleExpression(container map[string]interface{}, arg Argument) (string, error) {
+	if expression, ok := arg.rawArg.(string); ok && !strings.HasPrefix(expression, "$") {
+		return expression, nil
+	}
+	evaluated, err := arg.Evaluate(container)
+	if err != nil {
+		return "", err
+	}
+	expression, ok := evaluated.(string)
+	if !ok {
+		return "", errors.New(fmt.Sprintf("schedule expression must be string. %v", evaluated))
+	}
+	return expression, nil
+}
+
+func scheduleOptions(raw interface{}, job *scheduledJob) error {
+	if raw == nil {
+		return nil
+	}
+	options, ok := toStringKeyMap(raw)
+	if !ok {
+		return errors.New(fmt.Sprintf("schedule options must be map. %v", raw))
+	}
+	for key, value := range options {
+		switch key {
+		case "id":
+			job.id = fmt.Sprint(value)
+		case "timezone":
+			location, err := time.LoadLocation(fmt.Sprint(value))
+			if err != nil {
+				return err
+			}
+			job.location = location
+		case "jitter":
+			jitter, err := toDuration(value)
+			if err != nil {
+				return err
+			}
+			job.jitter = jitter
+		case "overlap":
+			switch value {
+			case "skip", "allow":
+				job.overlap = value.(string)
+			default:
+				return errors.New(fmt.Sprintf("schedule overlap must be skip or allow. %v", value))
+			}
+		default:
+			return errors.New(fmt.Sprintf("schedule unknown option: %v", key))
+		}
+	}
+	return nil
+}
+
+func (job *scheduledJob) fire(scheduledAt time.Time) {
+	scheduleMutex.Lock()
+	if job.overlap == "skip" && job.running > 0 {
+		job.skipped++
+		scheduleMutex.Unlock()
+		fmt.Println("schedule skipped, previous run still running", job.id)
+		return
+	}
+	job.running++
+	job.runs++
+	job.lastRun = time.Now()
+	newContainer := map[string]interface{}{}
+	for key, value := range job.container {
+		newContainer[key] = value
+	}
+	scheduleMutex.Unlock()
+	newContainer["scheduleId"] = job.id
+	newContainer["scheduledAt"] = scheduledAt.In(job.location).Format(time.RFC3339)
+	go func() {
+		defer func() {
+			scheduleMutex.Lock()
+			job.running--
+			scheduleMutex.Unlock()
+		}()
+		if _, err := job.body.Evaluate(newContainer); err != nil {
+			fmt.Println("schedule error", job.id, err)
+		}
+	}()
+}
+
+func (job *scheduledJob) loop(exitChannel chan int) {
+	defer func() {
+		scheduleMutex.Lock()
+		delete(scheduledJobs, job.id)
+		scheduleMutex.Unlock()
+	}()
+	ctx := containerContext(job.container)
+	last := time.Now()
+	for {
+		next := job.schedule.next(last)
+		if next.IsZero() {
+			fmt.Println("schedule has no next run", job.id)
+			reportWorkerExit(job.container, exitChannel, nil)
+			return
+		}
+		delay := time.Until(next)
+		if job.jitter > 0 {
+			delay += time.Duration(rand.Int63n(int64(job.jitter)))
+		}
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+			job.fire(next)
+			last = next
+			if now := time.Now(); now.After(last) {
+				last = now
+			}
+		case <-exitChannel:
+			timer.Stop()
+			fmt.Println("exit schedule", job.id)
+			return
+		case <-ctx.Done():
+			timer.Stop()
+			fmt.Println("schedule cancelled", job.id, ctx.Err())
+			reportWorkerExit(job.container, exitChannel, ctx.Err())
+			return
+		}
+	}
+}
+
+func scheduleRecords() []interface{} {
+	scheduleMutex.RLock()
+	defer scheduleMutex.RUnlock()
+	ids := []string{}
+	for id := range scheduledJobs {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	result := []interface{}{}
+	for _, id := range ids {
+		job := scheduledJobs[id]
+		record := map[string]interface{}{
+			"id":         job.id,
+			"expression": job.expression,
+			"timezone":   job.location.String(),
+			"overlap":    job.overlap,
+			"running":    job.running > 0,
+			"runs":       job.runs,
+			"skipped":    job.skipped,
+			"lastRun":    nil,
+			"next":       nextRuns(job.schedule, job.location, time.Now(), 3),
+		}
+		if !job.lastRun.IsZero() {
+			record["lastRun"] = job.lastRun.In(job.location).Format(time.RFC3339)
+		}
+		result = append(result, record)
+	}
+	return result
+}
+
+func init() {
+	DslFunctions["schedule"] = func(container map[string]interface{}, args ...Argument) (interface{}, error) {
+		typedExpression, err := scheduleExpression(container, args[0])
+		if err != nil {
+			return nil, err
+		}
+		job := &scheduledJob{
+			id:         newRandomId(),
+			expression: typedExpression,
+			location:   time.Local,
+			overlap:    "skip",
+			body:       args[1],
+			container:  map[string]interface{}{},
+		}
+		if len(args) > 2 {
+			options, err := args[2].Evaluate(container)
+			if err != nil {
+				return nil, err
+			}
+			if err := scheduleOptions(options, job); err != nil {
+				return nil, err
+			}
+		}
+		job.schedule, err = parseSchedule(typedExpression, job.location)
+		if err != nil {
+			return nil, err
+		}
+		for key, value := range container {
+			job.container[key] = value
+		}
+		scheduleMutex.Lock()
+		if _, ok := scheduledJobs[job.id]; ok {
+			scheduleMutex.Unlock()
+			return nil, errors.New(fmt.Sprintf("schedule already exists: %v", job.id))
+		}
+		scheduledJobs[job.id] = job
+		scheduleMutex.Unlock()
+		exitChannel := make(chan int)
+		go job.loop(exitChannel)
+		return exitChannel, nil
+	}
+
+	DslFunctions["schedules"] = func(container map[string]interface{}, args ...Argument) (interface{}, error) {
+		return scheduleRecords(), nil
+	}
+
+	DslFunctions["scheduleNext"] = func(container map[string]interface{}, args ...Argument) (interface{}, error) {
+		expression, err := scheduleExpression(container, args[0])
+		if err != nil {
+			return nil, err
+		}
+		evaluated, err := evaluateAll(args[1:], container)
+		if err != nil {
+			return nil, err
+		}
+		n := 5
+		if len(evaluated) > 0 && evaluated[0] != nil {
+			n, err = toInt(evaluated[0])
+			if err != nil {
+				return nil, err
+			}
+		}
+		location := time.Local
+		if len(evaluated) > 1 && evaluated[1] != nil {
+			options, ok := toStringKeyMap(evaluated[1])
+			if !ok {
+				return nil, errors.New(fmt.Sprintf("scheduleNext options must be map. %v", evaluated[1]))
+			}
+			if timezone, ok := options["timezone"]; ok {
+				location, err = time.LoadLocation(fmt.Sprint(timezone))
+				if err != nil {
+					return nil, err
+				}
+			}
+		}
+		s, err := parseSchedule(expression, location)
+		if err != nil {
+			return nil, err
+		}
+		return nextRuns(s, location, time.Now(), n), nil
+	}
+}
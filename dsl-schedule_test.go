@@ -0,0 +1,82 @@
+package mydslgo
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseScheduleErrors(t *testing.T) {
+	for _, expression := range []string{
+		"* * * *",
+		"* * * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"*/0 * * * *",
+		"5-1 * * * *",
+		"* * * foo *",
+		"@every 500ms",
+		"@every soon",
+		"@weekdays",
+	} {
+		if _, err := parseSchedule(expression, time.UTC); err == nil {
+			t.Errorf("%v: expected error", expression)
+		}
+	}
+}
+
+func TestScheduleNext(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skip(err)
+	}
+	kolkata, err := time.LoadLocation("Asia/Kolkata")
+	if err != nil {
+		t.Skip(err)
+	}
+	tests := []struct {
+		expression string
+		location   *time.Location
+		from       string
+		expected   []string
+	}{
+		{"*/15 * * * *", time.UTC, "2026-01-01T00:07:30Z", []string{"2026-01-01T00:15:00Z", "2026-01-01T00:30:00Z"}},
+		{"30 * * * * *", time.UTC, "2026-01-01T10:00:45Z", []string{"2026-01-01T10:01:30Z"}},
+		{"0 9 * * mon-fri", time.UTC, "2026-01-02T10:00:00Z", []string{"2026-01-05T09:00:00Z"}},
+		{"0 0 13 * fri", time.UTC, "2026-01-01T00:00:00Z", []string{"2026-01-02T00:00:00Z", "2026-01-09T00:00:00Z"}},
+		{"0 0 * * 7", time.UTC, "2026-01-01T00:00:00Z", []string{"2026-01-04T00:00:00Z"}},
+		{"0 0 29 feb *", time.UTC, "2026-03-01T00:00:00Z", []string{"2028-02-29T00:00:00Z"}},
+		{"0 0 31 2 *", time.UTC, "2026-01-01T00:00:00Z", []string{}},
+		{"@daily", time.UTC, "2026-01-01T00:00:00Z", []string{"2026-01-02T00:00:00Z"}},
+		{"@every 90s", time.UTC, "2026-01-01T10:00:00Z", []string{"2026-01-01T10:01:30Z", "2026-01-01T10:03:00Z"}},
+		{"0 * * * *", kolkata, "2026-01-01T10:10:00+05:30", []string{"2026-01-01T11:00:00+05:30"}},
+		{"0 * * * *", newYork, "2026-03-08T01:30:00-05:00", []string{"2026-03-08T03:00:00-04:00", "2026-03-08T04:00:00-04:00"}},
+		{"30 2 * * *", newYork, "2026-03-07T12:00:00-05:00", []string{"2026-03-09T02:30:00-04:00"}},
+		{"0 3 * * *", newYork, "2026-03-08T00:00:00-05:00", []string{"2026-03-08T03:00:00-04:00"}},
+		{"0 * * * *", newYork, "2026-11-01T00:30:00-04:00", []string{"2026-11-01T01:00:00-04:00", "2026-11-01T01:00:00-05:00", "2026-11-01T02:00:00-05:00"}},
+		{"30 1 * * *", newYork, "2026-11-01T00:00:00-04:00", []string{"2026-11-01T01:30:00-04:00", "2026-11-01T01:30:00-05:00", "2026-11-02T01:30:00-05:00"}},
+	}
+	for _, test := range tests {
+		s, err := parseSchedule(test.expression, test.location)
+		if err != nil {
+			t.Fatalf("%v: %v", test.expression, err)
+		}
+		from, err := time.Parse(time.RFC3339, test.from)
+		if err != nil {
+			t.Fatal(err)
+		}
+		runs := nextRuns(s, test.location, from, len(test.expected))
+		if len(runs) != len(test.expected) {
+			t.Errorf("%v from %v: expected %v, got %v", test.expression, test.from, test.expected, runs)
+			continue
+		}
+		for index, run := range runs {
+			if run != test.expected[index] {
+				t.Errorf("%v from %v: expected %v, got %v", test.expression, test.from, test.expected, runs)
+				break
+			}
+		}
+	}
+}
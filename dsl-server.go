@@ -1,6 +1,7 @@
 package mydslgo
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -8,12 +9,13 @@ import (
 	"github.com/gorilla/websocket"
 	"github.com/mongodb/mongo-go-driver/bson/primitive"
 	"html/template"
-	_ "io"
+	"io"
 	"log"
+	"net"
 	"net/http"
 	_ "reflect"
-	"regexp"
 	"strings"
+	"time"
 )
 
 var upgrader = websocket.Upgrader{}
@@ -27,53 +29,302 @@ var templateFuncs = template.FuncMap{
 	},
 }
 
+func valuesToMap(values map[string][]string) map[string]interface{} {
+	result := map[string]interface{}{}
+	for key, value := range values {
+		if len(value) == 1 {
+			result[key] = value[0]
+		} else {
+			items := []interface{}{}
+			for _, item := range value {
+				items = append(items, item)
+			}
+			result[key] = items
+		}
+	}
+	return result
+}
+
+type requestBodyContextKey struct{}
+
+type parsedRequestBody struct {
+	body interface{}
+}
+
+func requestBody(req *http.Request) (interface{}, error) {
+	if parsed, ok := req.Context().Value(requestBodyContextKey{}).(parsedRequestBody); ok {
+		return parsed.body, nil
+	}
+	var body interface{}
+	contentType := req.Header.Get("Content-Type")
+	if strings.HasPrefix(contentType, "application/json") {
+		if err := json.NewDecoder(req.Body).Decode(&body); err != nil && err != io.EOF {
+			return nil, err
+		}
+	} else if strings.HasPrefix(contentType, "multipart/form-data") {
+		if err := req.ParseMultipartForm(32 << 20); err != nil {
+			return nil, err
+		}
+		body = valuesToMap(req.PostForm)
+	} else if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		if err := req.ParseForm(); err != nil {
+			return nil, err
+		}
+		body = valuesToMap(req.PostForm)
+	}
+	return body, nil
+}
+
+func requestObject(req *http.Request) (map[string]interface{}, error) {
+	params := map[string]interface{}{}
+	if routeContext := chi.RouteContext(req.Context()); routeContext != nil {
+		for index, key := range routeContext.URLParams.Keys {
+			if key != "*" || routeContext.URLParams.Values[index] != "" {
+				params[key] = routeContext.URLParams.Values[index]
+			}
+		}
+	}
+	cookies := map[string]interface{}{}
+	for _, cookie := range req.Cookies() {
+		cookies[cookie.Name] = cookie.Value
+	}
+	body, err := requestBody(req)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{
+		"method":  req.Method,
+		"path":    req.URL.Path,
+		"params":  params,
+		"query":   valuesToMap(req.URL.Query()),
+		"headers": valuesToMap(req.Header),
+		"cookies": cookies,
+		"body":    body,
+	}, nil
+}
+
+func evaluateWithRouter(container map[string]interface{}, router chi.Router, arg Argument) error {
+	parentRouter, hasParent := container["router"]
+	container["router"] = router
+	_, err := arg.Evaluate(container)
+	if hasParent {
+		container["router"] = parentRouter
+	} else {
+		delete(container, "router")
+	}
+	return err
+}
+
+func responseWriter(container map[string]interface{}) (http.ResponseWriter, error) {
+	res, ok := container["res"].(http.ResponseWriter)
+	if !ok {
+		return nil, errors.New("res is not set. response helpers must be called inside handler.")
+	}
+	return res, nil
+}
+
+func evaluateStatus(container map[string]interface{}, arg Argument) (int, error) {
+	evaluated, err := arg.Evaluate(container)
+	if err != nil {
+		return 0, err
+	}
+	status, err := toInt(evaluated)
+	if err != nil || status < 100 || status > 999 {
+		return 0, errors.New(fmt.Sprintf("invalid status code. %v", evaluated))
+	}
+	return status, nil
+}
+
+func toBytes(any interface{}) []byte {
+	switch value := any.(type) {
+	case string:
+		return []byte(value)
+	case []byte:
+		return value
+	case nil:
+		return []byte{}
+	}
+	return []byte(fmt.Sprint(any))
+}
+
+func serverArguments(raw interface{}) []Argument {
+	wrapped := []Argument{}
+	for _, rawArg := range asArray(raw) {
+		wrapped = append(wrapped, NewArgument(rawArg))
+	}
+	return wrapped
+}
+
+func routerCall(name string, register func()) (err error) {
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			err = errors.New(fmt.Sprintf("%v: %v", name, recovered))
+		}
+	}()
+	register()
+	return nil
+}
+
+func registerServer(container map[string]interface{}, router chi.Router, definition map[string]interface{}) error {
+	if definition["middleware"] != nil {
+		for _, rawMiddleware := range toInterfaceSlice(definition["middleware"]) {
+			var handler func(http.Handler) http.Handler
+			var err error
+			if _, ok := rawMiddleware.([]interface{}); ok {
+				handler, err = middlewareFor(container, serverArguments(rawMiddleware))
+			} else {
+				handler, err = middlewareFor(container, []Argument{NewArgument(rawMiddleware)})
+			}
+			if err != nil {
+				return err
+			}
+			if err := routerCall("server middleware", func() { router.Use(handler) }); err != nil {
+				return err
+			}
+		}
+	}
+	if static, ok := toStringKeyMap(definition["static"]); ok {
+		for pattern, dir := range static {
+			prefix := strings.TrimSuffix(pattern, "/")
+			fileServer := http.StripPrefix(prefix, http.FileServer(http.Dir(fmt.Sprint(dir))))
+			router.Handle(prefix+"/*", fileServer)
+		}
+	}
+	if definition["routes"] != nil {
+		for _, rawRoute := range toInterfaceSlice(definition["routes"]) {
+			var err error
+			if _, ok := rawRoute.([]interface{}); ok {
+				_, err = callBuiltin(container, "handler", serverArguments(rawRoute)...)
+			} else {
+				_, err = NewArgument(rawRoute).Evaluate(container)
+			}
+			if err != nil {
+				return err
+			}
+		}
+	}
+	if definition["websockets"] != nil {
+		for _, rawWebsocket := range toInterfaceSlice(definition["websockets"]) {
+			if _, err := callBuiltin(container, "wsHandler", serverArguments(rawWebsocket)...); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
 func init() {
 	DslAvailableFunctions["chi.NewRouter"] = chi.NewRouter
 	DslAvailableFunctions["chi.URLParam"] = chi.URLParam
 	DslAvailableFunctions["http.ListenAndServe"] = http.ListenAndServe
 
 	DslFunctions["wsHandler"] = func(container map[string]interface{}, args ...Argument) (interface{}, error) {
-		mux := container["router"].(*chi.Mux)
+		mux, ok := container["router"].(chi.Router)
+		if !ok {
+			return nil, errors.New("wsHandler: router is not set.")
+		}
+		var options *wsHandlerOptions
+		var err error
+		if len(args) > 3 {
+			options, err = parseWsHandlerOptions(args[3].rawArg)
+		} else {
+			options, err = parseWsHandlerOptions(nil)
+		}
+		if err != nil {
+			return nil, err
+		}
 
+		inherited := inheritedValues(container)
 		mux.Get(args[0].rawArg.(string), func(w http.ResponseWriter, r *http.Request) {
 			c, err := upgrader.Upgrade(w, r, nil)
 			if err != nil {
 				log.Print("upgrade:", err)
 				return
 			}
-			newContainer := map[string]interface{}{"conn": c}
+			connection := registerConnection(c)
+			newContainer := map[string]interface{}{"conn": c, "connId": connection.id, "context": r.Context()}
+			for key, value := range inherited {
+				newContainer[key] = value
+			}
+			for key, value := range middlewareValues(r) {
+				newContainer[key] = value
+			}
+			done := make(chan int)
+			defer func() {
+				close(done)
+				unregisterConnection(connection)
+				c.Close()
+				if len(args) > 2 {
+					args[2].Evaluate(newContainer)
+				}
+			}()
+			options.keepalive(connection, done)
+			if options.connect != nil {
+				if _, err := options.connect.Evaluate(newContainer); err != nil {
+					log.Println("connect:", err)
+					return
+				}
+			}
 			for {
-				_, message, err := c.ReadMessage()
+				messageType, message, err := c.ReadMessage()
 				if err != nil {
 					log.Println("read:", err)
 					break
 				}
-				var data interface{}
-				err = json.Unmarshal(message, &data)
-				newContainer["message"] = data
-				if err != nil {
-					fmt.Println("unmarshal error", err, data)
-					break
+				if options.readTimeout > 0 {
+					c.SetReadDeadline(time.Now().Add(options.readTimeout))
+				}
+				delete(newContainer, "messageError")
+				body := args[1]
+				if messageType == websocket.BinaryMessage {
+					newContainer["message"] = message
+					newContainer["messageType"] = "binary"
+					if options.binary != nil {
+						body = *options.binary
+					}
+				} else {
+					var data interface{}
+					err = json.Unmarshal(message, &data)
+					newContainer["messageType"] = "text"
+					if err != nil {
+						newContainer["message"] = string(message)
+						newContainer["messageError"] = err.Error()
+						if options.malformed == nil {
+							fmt.Println("unmarshal error", err, string(message))
+							continue
+						}
+						body = *options.malformed
+					} else {
+						newContainer["message"] = data
+						body = options.bodyFor(data, body)
+					}
+				}
+				if _, err := body.Evaluate(newContainer); err != nil {
+					log.Println("wsHandler:", err)
 				}
-				args[1].Evaluate(newContainer)
 			}
-			defer func() {
-				c.Close()
-				args[2].Evaluate(newContainer)
-			}()
-
 		})
 		return nil, nil
 	}
 
 	DslFunctions["wsWrite"] = func(container map[string]interface{}, args ...Argument) (interface{}, error) {
-		conn := container["conn"].(*websocket.Conn)
+		connection, err := containerConnection(container)
+		if err != nil {
+			return nil, err
+		}
 		evaluated, err := args[0].Evaluate(container)
 		if err != nil {
 			return nil, err
 		}
-		b, err := json.Marshal(evaluated)
-		err = conn.WriteMessage(1, []byte(b))
+		if len(args) > 1 && args[1].rawArg == "binary" {
+			err = connection.write(websocket.BinaryMessage, toBytes(evaluated))
+		} else {
+			b, marshalErr := json.Marshal(toJsonCompatible(evaluated))
+			if marshalErr != nil {
+				return nil, marshalErr
+			}
+			err = connection.write(websocket.TextMessage, b)
+		}
 		if err != nil {
 			log.Println("write:", err)
 			return nil, err
@@ -82,217 +333,388 @@ func init() {
 	}
 
 	DslFunctions["handler"] = func(container map[string]interface{}, args ...Argument) (interface{}, error) {
-		method := args[0].rawArg
-		endpoint := args[1].rawArg
-		viewOrLogic := args[2].rawArg
-		if _, ok := viewOrLogic.(string); ok {
-			return nil, nil // TBD
-		} else {
-			if method == "get" {
-				(container["router"].(*chi.Mux)).Get(endpoint.(string), func(res http.ResponseWriter, req *http.Request) {
-					newContainer := map[string]interface{}{"req": req, "res": res}
-					args[2].Evaluate(newContainer)
-				})
-				return nil, nil
+		method, ok := args[0].rawArg.(string)
+		if !ok {
+			return nil, errors.New(fmt.Sprintf("handler method must be string. %v", args[0].rawArg))
+		}
+		endpoint, ok := args[1].rawArg.(string)
+		if !ok {
+			return nil, errors.New(fmt.Sprintf("handler endpoint must be string. %v", args[1].rawArg))
+		}
+		router, ok := container["router"].(chi.Router)
+		if !ok {
+			return nil, errors.New("handler: router is not set.")
+		}
+		inherited := inheritedValues(container)
+		handlerFunc := func(res http.ResponseWriter, req *http.Request) {
+			request, err := requestObject(req)
+			if err != nil {
+				http.Error(res, err.Error(), http.StatusBadRequest)
+				return
+			}
+			newContainer := map[string]interface{}{"req": req, "res": res, "request": request, "context": req.Context()}
+			for key, value := range inherited {
+				newContainer[key] = value
+			}
+			for key, value := range middlewareValues(req) {
+				newContainer[key] = value
+			}
+			if view, ok := args[2].rawArg.(string); ok {
+				_, err = callBuiltin(newContainer, "render", NewArgument(view), NewArgument("$.request"))
 			} else {
-				(container["router"].(*chi.Mux)).Post(endpoint.(string), func(res http.ResponseWriter, req *http.Request) {
-					newContainer := map[string]interface{}{"req": req, "res": res}
-					args[2].Evaluate(newContainer)
-				})
-				return nil, nil // TBD
+				_, err = args[2].Evaluate(newContainer)
+			}
+			if err != nil {
+				log.Println("handler:", method, endpoint, err)
+			}
+		}
+		return nil, routerCall("handler "+method+" "+endpoint, func() {
+			switch strings.ToLower(method) {
+			case "any", "*":
+				router.HandleFunc(endpoint, handlerFunc)
+			default:
+				router.MethodFunc(strings.ToUpper(method), endpoint, handlerFunc)
+			}
+		})
+	}
+
+	DslFunctions["route"] = func(container map[string]interface{}, args ...Argument) (interface{}, error) {
+		pattern, ok := args[0].rawArg.(string)
+		if !ok {
+			return nil, errors.New(fmt.Sprintf("route pattern must be string. %v", args[0].rawArg))
+		}
+		router, ok := container["router"].(chi.Router)
+		if !ok {
+			return nil, errors.New("route: router is not set.")
+		}
+		var err error
+		router.Route(pattern, func(subRouter chi.Router) {
+			err = evaluateWithRouter(container, subRouter, args[1])
+		})
+		return nil, err
+	}
+
+	DslFunctions["group"] = func(container map[string]interface{}, args ...Argument) (interface{}, error) {
+		router, ok := container["router"].(chi.Router)
+		if !ok {
+			return nil, errors.New("group: router is not set.")
+		}
+		var err error
+		router.Group(func(groupRouter chi.Router) {
+			err = evaluateWithRouter(container, groupRouter, args[0])
+		})
+		return nil, err
+	}
+
+	DslFunctions["server"] = func(container map[string]interface{}, args ...Argument) (interface{}, error) {
+		definition, ok := toStringKeyMap(args[0].rawArg)
+		if !ok {
+			return nil, errors.New(fmt.Sprintf("server definition must be map. %v", args[0].rawArg))
+		}
+		address, err := NewArgument(definition["address"]).Evaluate(container)
+		if err != nil {
+			return nil, err
+		}
+		if address == nil {
+			address = ":8080"
+		}
+		drainTimeout := 10 * time.Second
+		if definition["drainTimeout"] != nil {
+			drainTimeout, err = toDuration(definition["drainTimeout"])
+			if err != nil {
+				return nil, err
 			}
 		}
+		router := chi.NewRouter()
+		parentRouter, hasParent := container["router"]
+		container["router"] = router
+		err = registerServer(container, router, definition)
+		if hasParent {
+			container["router"] = parentRouter
+		} else {
+			delete(container, "router")
+		}
+		if err != nil {
+			return nil, err
+		}
+		listener, err := net.Listen("tcp", toString(address))
+		if err != nil {
+			return nil, err
+		}
+		httpServer := &http.Server{Handler: router}
+		exitChannel := make(chan int)
+		go func() {
+			if err := httpServer.Serve(listener); err != nil && err != http.ErrServerClosed {
+				log.Println("server:", err)
+				reportWorkerExit(container, exitChannel, err)
+			}
+		}()
+		go func() {
+			<-exitChannel
+			ctx, cancel := context.WithTimeout(context.Background(), drainTimeout)
+			defer cancel()
+			if err := httpServer.Shutdown(ctx); err != nil {
+				log.Println("server shutdown:", err)
+			}
+			fmt.Println("exit server", listener.Addr())
+		}()
+		fmt.Println("server started", listener.Addr())
+		return exitChannel, nil
 	}
 
 	DslFunctions["send"] = func(container map[string]interface{}, args ...Argument) (interface{}, error) {
+		res, err := responseWriter(container)
+		if err != nil {
+			return nil, err
+		}
 		evaluated, err := args[0].Evaluate(container)
 		if err != nil {
 			return nil, err
 		}
-		(container["res"].(http.ResponseWriter)).Write([]byte(evaluated.(string))) // TBD
-		return nil, nil
+		_, err = res.Write(toBytes(evaluated))
+		return nil, err
 	}
 
-	DslFunctions["render"] = func(container map[string]interface{}, args ...Argument) (interface{}, error) {
+	DslFunctions["sendJson"] = func(container map[string]interface{}, args ...Argument) (interface{}, error) {
+		res, err := responseWriter(container)
+		if err != nil {
+			return nil, err
+		}
 		evaluated, err := args[0].Evaluate(container)
-		templateArgument, err := args[1].Evaluate(container)
 		if err != nil {
 			return nil, err
 		}
-		t, err := template.New("titleTest").Funcs(templateFuncs).ParseFiles("templates/" + evaluated.(string))
-		if err := t.ExecuteTemplate((container["res"].(http.ResponseWriter)), evaluated.(string), templateArgument); err != nil {
-			// log.Fatal(err)
+		b, err := json.Marshal(toJsonCompatible(evaluated))
+		if err != nil {
+			return nil, err
+		}
+		res.Header().Set("Content-Type", "application/json")
+		if len(args) > 1 {
+			status, err := evaluateStatus(container, args[1])
+			if err != nil {
+				return nil, err
+			}
+			res.WriteHeader(status)
 		}
+		_, err = res.Write(b)
+		return nil, err
+	}
+
+	DslFunctions["sendStatus"] = func(container map[string]interface{}, args ...Argument) (interface{}, error) {
+		res, err := responseWriter(container)
+		if err != nil {
+			return nil, err
+		}
+		status, err := evaluateStatus(container, args[0])
+		if err != nil {
+			return nil, err
+		}
+		res.WriteHeader(status)
 		return nil, nil
 	}
-	DslFunctions["redirect"] = func(container map[string]interface{}, args ...Argument) (interface{}, error) {
-		toRedirect := args[0].rawArg.(string)
-		http.Redirect((container["res"].(http.ResponseWriter)), (container["req"].(*http.Request)), toRedirect, http.StatusMovedPermanently)
+
+	DslFunctions["setHeader"] = func(container map[string]interface{}, args ...Argument) (interface{}, error) {
+		res, err := responseWriter(container)
+		if err != nil {
+			return nil, err
+		}
+		evaluated, err := evaluateAll(args, container)
+		if err != nil {
+			return nil, err
+		}
+		res.Header().Set(fmt.Sprint(evaluated[0]), fmt.Sprint(evaluated[1]))
 		return nil, nil
 	}
 
-	var processes = map[string]chan int{}
-	var processIdPattern = regexp.MustCompile(`^(.+)(\d{13})$`)
-	DslFunctions["processStart"] = func(container map[string]interface{}, args ...Argument) (interface{}, error) {
-		processId, err := args[0].Evaluate(container)
+	DslFunctions["setCookie"] = func(container map[string]interface{}, args ...Argument) (interface{}, error) {
+		res, err := responseWriter(container)
 		if err != nil {
 			return nil, err
-		} else {
-			fmt.Println("process start", processId.(string), args[1])
-			dsl, err := args[1].Evaluate(container)
-			if err != nil {
-				return nil, err
+		}
+		evaluated, err := evaluateAll(args, container)
+		if err != nil {
+			return nil, err
+		}
+		cookie := &http.Cookie{Name: fmt.Sprint(evaluated[0]), Value: fmt.Sprint(evaluated[1]), Path: "/"}
+		if len(evaluated) > 2 {
+			options, ok := toStringKeyMap(evaluated[2])
+			if !ok {
+				return nil, errors.New(fmt.Sprintf("setCookie options must be map. %v", evaluated[2]))
+			}
+			if path, ok := options["path"].(string); ok {
+				cookie.Path = path
+			}
+			if domain, ok := options["domain"].(string); ok {
+				cookie.Domain = domain
+			}
+			if maxAge, ok := options["maxAge"].(int); ok {
+				cookie.MaxAge = maxAge
+			}
+			if httpOnly, ok := options["httpOnly"].(bool); ok {
+				cookie.HttpOnly = httpOnly
+			}
+			if secure, ok := options["secure"].(bool); ok {
+				cookie.Secure = secure
+			}
+			switch options["sameSite"] {
+			case "lax":
+				cookie.SameSite = http.SameSiteLaxMode
+			case "strict":
+				cookie.SameSite = http.SameSiteStrictMode
 			}
-			gochan := make(chan int)
-			go func() {
-				result, err := NewArgument(dsl).Evaluate(map[string]interface{}{})
-				if err == nil {
-					if typedResult, ok := result.(chan int); ok {
-						processes[processId.(string)] = typedResult
-						fmt.Println("process start result", result)
-					} else {
-						fmt.Println("no channel returned.")
-					}
-				}
-				gochan <- 1
-			}()
-			<-gochan
 		}
+		http.SetCookie(res, cookie)
 		return nil, nil
 	}
-	DslFunctions["processKill"] = func(container map[string]interface{}, args ...Argument) (interface{}, error) {
-		processId, err := args[0].Evaluate(container)
+
+	DslFunctions["sendFile"] = func(container map[string]interface{}, args ...Argument) (interface{}, error) {
+		res, err := responseWriter(container)
 		if err != nil {
 			return nil, err
 		}
-		if processId == nil {
-			return nil, nil
+		req, ok := container["req"].(*http.Request)
+		if !ok {
+			return nil, errors.New("sendFile: req is not set.")
+		}
+		evaluated, err := args[0].Evaluate(container)
+		if err != nil {
+			return nil, err
 		}
-
-		channel, ok := processes[processId.(string)]
+		path, ok := evaluated.(string)
 		if !ok {
-			return nil, errors.New("channel not found")
+			return nil, errors.New(fmt.Sprintf("sendFile path must be string. %v", evaluated))
 		}
-		channel <- 0
-		close(channel)
-		delete(processes, processId.(string))
+		http.ServeFile(res, req, path)
 		return nil, nil
 	}
 
-	DslFunctions["processes"] = func(container map[string]interface{}, args ...Argument) (interface{}, error) {
-		result := map[interface{}][]string{}
-		for key, _ := range processes {
-			match := processIdPattern.FindStringSubmatch(key)
-			yamlId := match[1]
-			if slice, ok := result[yamlId]; ok {
-				slice = append(slice, match[2])
-				result[yamlId] = slice
-			} else {
-				result[yamlId] = []string{match[2]}
+	DslFunctions["sendStream"] = func(container map[string]interface{}, args ...Argument) (interface{}, error) {
+		res, err := responseWriter(container)
+		if err != nil {
+			return nil, err
+		}
+		req, ok := container["req"].(*http.Request)
+		if !ok {
+			return nil, errors.New("sendStream: req is not set.")
+		}
+		mode, ok := args[0].rawArg.(string)
+		if !ok || (mode != "sse" && mode != "chunked") {
+			return nil, errors.New(fmt.Sprintf("sendStream mode must be sse or chunked. %v", args[0].rawArg))
+		}
+		if _, ok := res.(http.Flusher); !ok {
+			return nil, errors.New("sendStream: response does not support streaming.")
+		}
+		if mode == "sse" {
+			res.Header().Set("Content-Type", "text/event-stream")
+			res.Header().Set("Cache-Control", "no-cache")
+			res.Header().Set("Connection", "keep-alive")
+		}
+		container["streamMode"] = mode
+		defer delete(container, "streamMode")
+		if _, err := args[1].Evaluate(container); err != nil {
+			return nil, err
+		}
+		if len(args) > 2 {
+			exitChannel, err := callBuiltin(container, "subscribe", args[2], Argument{map[interface{}]interface{}{
+				"streamWrite": "$.subscribe",
+			}}, Argument{[]interface{}{"res", "streamMode"}})
+			if err != nil {
+				return nil, err
 			}
+			<-req.Context().Done()
+			exitChannel.(chan int) <- 0
 		}
-		//fmt.Println("processes...", result)
-		//result["5c40351e93ac4c189d09d789"] = []string{"111111"}
-		return result, nil
+		return nil, nil
 	}
 
-	pubsubChannels := map[string][]chan interface{}{}
-
-	DslFunctions["subscribe"] = func(container map[string]interface{}, args ...Argument) (interface{}, error) {
-		exitChannel := make(chan int)
-		channel := make(chan interface{})
-		evaluated, err := args[0].Evaluate(container)
+	DslFunctions["streamWrite"] = func(container map[string]interface{}, args ...Argument) (interface{}, error) {
+		res, err := responseWriter(container)
 		if err != nil {
 			return nil, err
 		}
-		channelName, ok := evaluated.(string)
-		if !ok {
-			return nil, errors.New(fmt.Sprintf("subscribe channel name must be string. %v", channelName))
+		evaluated, err := evaluateAll(args, container)
+		if err != nil {
+			return nil, err
 		}
-		go func() {
-			for {
-				select {
-				case data := <-channel:
-					newContainer := map[string]interface{}{"subscribe": data, "channelName": channelName}
-					if len(args) > 2 {
-						for _, key := range args[2].rawArg.([]interface{}) {
-							newContainer[key.(string)] = container[key.(string)]
-						}
-					}
-					args[1].Evaluate(newContainer)
-				case <-exitChannel:
-					channels := pubsubChannels[channelName]
-					removed := []chan interface{}{}
-					for _, ch := range channels {
-						if ch != channel {
-							removed = append(removed, ch)
-						}
-					}
-					pubsubChannels[channelName] = removed
-					close(channel)
-					fmt.Println("channel closed", pubsubChannels)
-					return
+		var chunk []byte
+		if container["streamMode"] == "sse" {
+			data, ok := evaluated[0].(string)
+			if !ok {
+				b, err := json.Marshal(toJsonCompatible(evaluated[0]))
+				if err != nil {
+					return nil, err
 				}
+				data = string(b)
 			}
-		}()
-		if channels, ok := pubsubChannels[channelName]; ok {
-			channels = append(channels, channel)
-			pubsubChannels[channelName] = channels
+			event := ""
+			if len(evaluated) > 1 {
+				event = fmt.Sprintf("event: %v\n", evaluated[1])
+			}
+			chunk = []byte(event + "data: " + strings.Replace(data, "\n", "\ndata: ", -1) + "\n\n")
 		} else {
-			pubsubChannels[channelName] = []chan interface{}{channel}
-			// TBD
-			if channelName != "channelList" {
-				NewArgument(map[interface{}]interface{}{
-					"publish": []interface{}{
-						"channelList",
-						map[interface{}]interface{}{"channelList": nil},
-					},
-				}).Evaluate(map[string]interface{}{})
-			}
-		}
-		fmt.Println("add subscribe channels", pubsubChannels)
-		return exitChannel, nil
+			chunk = toBytes(evaluated[0])
+		}
+		if _, err := res.Write(chunk); err != nil {
+			return nil, err
+		}
+		if flusher, ok := res.(http.Flusher); ok {
+			flusher.Flush()
+		}
+		return nil, nil
 	}
 
-	DslFunctions["publish"] = func(container map[string]interface{}, args ...Argument) (interface{}, error) {
-		channelName, err := args[0].Evaluate(container)
+	DslFunctions["render"] = func(container map[string]interface{}, args ...Argument) (interface{}, error) {
+		res, err := responseWriter(container)
 		if err != nil {
 			return nil, err
 		}
-		typedChannelName, ok := channelName.(string)
-		if !ok {
-			return nil, errors.New(fmt.Sprintf("publish channel name must be string. %v", channelName))
-		}
-		evaluated, err := args[1].Evaluate(container)
+		evaluated, err := args[0].Evaluate(container)
 		if err != nil {
 			return nil, err
 		}
-		if channels, ok := pubsubChannels[typedChannelName]; ok {
-			for _, channel := range channels {
-				go func(ch chan interface{}) {
-					ch <- evaluated
-				}(channel)
+		name, ok := evaluated.(string)
+		if !ok {
+			return nil, errors.New(fmt.Sprintf("render template name must be string. %v", evaluated))
+		}
+		var templateArgument interface{}
+		if len(args) > 1 {
+			templateArgument, err = args[1].Evaluate(container)
+			if err != nil {
+				return nil, err
 			}
-		} else {
-			fmt.Println(fmt.Sprintf("channel: %v has no subscribers.", typedChannelName))
-			pubsubChannels[typedChannelName] = []chan interface{}{}
-			// TBD
-			if typedChannelName != "channelList" {
-				NewArgument(map[interface{}]interface{}{
-					"publish": []interface{}{
-						"channelList",
-						map[interface{}]interface{}{"channelList": nil},
-					},
-				}).Evaluate(map[string]interface{}{})
+		}
+		layout := ""
+		if len(args) > 2 {
+			evaluatedLayout, err := args[2].Evaluate(container)
+			if err != nil {
+				return nil, err
 			}
+			layout = toString(evaluatedLayout)
 		}
-		return nil, nil
+		return nil, renderTemplate(res, name, layout, templateArgument)
 	}
-	DslFunctions["channelList"] = func(container map[string]interface{}, args ...Argument) (interface{}, error) {
-		result := []string{}
-		for key, _ := range pubsubChannels {
-			result = append(result, key)
+
+	DslFunctions["redirect"] = func(container map[string]interface{}, args ...Argument) (interface{}, error) {
+		res, err := responseWriter(container)
+		if err != nil {
+			return nil, err
 		}
-		return result, nil
+		evaluated, err := args[0].Evaluate(container)
+		if err != nil {
+			return nil, err
+		}
+		toRedirect, ok := evaluated.(string)
+		if !ok {
+			return nil, errors.New(fmt.Sprintf("redirect url must be string. %v", evaluated))
+		}
+		status := http.StatusMovedPermanently
+		if len(args) > 1 {
+			status, err = evaluateStatus(container, args[1])
+			if err != nil {
+				return nil, err
+			}
+		}
+		http.Redirect(res, (container["req"].(*http.Request)), toRedirect, status)
+		return nil, nil
 	}
 }
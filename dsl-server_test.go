@@ -0,0 +1,90 @@
+package mydslgo
+
+import (
+	"github.com/go-chi/chi"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func newTestServer(t *testing.T, src string) *httptest.Server {
+	t.Helper()
+	container := map[string]interface{}{"router": chi.NewRouter()}
+	mustEvaluateYaml(t, container, src)
+	server := httptest.NewServer(container["router"].(*chi.Mux))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func doTestRequest(t *testing.T, method string, url string, contentType string, body io.Reader) (int, string) {
+	t.Helper()
+	req, err := http.NewRequest(method, url, body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	b, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return res.StatusCode, strings.TrimSpace(string(b))
+}
+
+func TestSendStatusAndStatusLiteral(t *testing.T) {
+	server := newTestServer(t, `
+sequence:
+  - handler: [get, /literal, {sendJson: [{status: ok}]}]
+  - handler: [get, /missing, {sequence: [{sendStatus: 404}]}]
+`)
+	if status, body := doTestRequest(t, "GET", server.URL+"/literal", "", nil); status != 200 || body != `{"status":"ok"}` {
+		t.Fatalf("unexpected response: %v %v", status, body)
+	}
+	if status, _ := doTestRequest(t, "GET", server.URL+"/missing", "", nil); status != 404 {
+		t.Fatalf("unexpected status: %v", status)
+	}
+}
+
+func TestMiddlewareKeepsRequestBody(t *testing.T) {
+	server := newTestServer(t, `
+sequence:
+  - middleware: [{$.seen: true}]
+  - handler: [post, /echo, {sendJson: [{body: $.request.body, seen: $.seen}]}]
+`)
+	status, body := doTestRequest(t, "POST", server.URL+"/echo", "application/json", strings.NewReader(`{"name":"apple"}`))
+	if status != 200 || body != `{"body":{"name":"apple"},"seen":true}` {
+		t.Fatalf("unexpected response: %v %v", status, body)
+	}
+	status, body = doTestRequest(t, "POST", server.URL+"/echo", "application/x-www-form-urlencoded", strings.NewReader("name=pear"))
+	if status != 200 || body != `{"body":{"name":"pear"},"seen":true}` {
+		t.Fatalf("unexpected response: %v %v", status, body)
+	}
+}
+
+func TestHandlerRejectsUnknownMethod(t *testing.T) {
+	container := map[string]interface{}{"router": chi.NewRouter()}
+	for _, src := range []string{"handler: [fetch, /x, {sendStatus: 200}]", "handler: [get, no-slash, {sendStatus: 200}]"} {
+		if _, err := evaluateYaml(t, container, src); err == nil {
+			t.Errorf("%v: expected error", src)
+		}
+	}
+	mustEvaluateYaml(t, container, "handler: [patch, /x, {sendStatus: 204}]")
+}
+
+func TestMiddlewareAfterRoutes(t *testing.T) {
+	container := map[string]interface{}{"router": chi.NewRouter()}
+	mustEvaluateYaml(t, container, "handler: [get, /x, {sendStatus: 200}]")
+	_, err := evaluateYaml(t, container, "middleware: [{$.seen: true}]")
+	if err == nil || !strings.Contains(err.Error(), "middlewares must be defined before routes") {
+		t.Fatalf("expected descriptive error, got %v", err)
+	}
+}
@@ -0,0 +1,220 @@
+package mydslgo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+type sqlRunner interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+var sqlConnections = map[string]*sql.DB{}
+var sqlConnectionsMutex = sync.RWMutex{}
+
+func sqlRunnerFor(container map[string]interface{}, arg Argument) (sqlRunner, error) {
+	name, ok := arg.rawArg.(string)
+	if !ok {
+		return nil, errors.New(fmt.Sprintf("sql connection name must be string. %v", arg.rawArg))
+	}
+	if transactions, ok := container["sqlTx"].(map[string]*sql.Tx); ok {
+		if tx, ok := transactions[name]; ok {
+			return tx, nil
+		}
+	}
+	sqlConnectionsMutex.RLock()
+	db, ok := sqlConnections[name]
+	sqlConnectionsMutex.RUnlock()
+	if !ok {
+		return nil, errors.New(fmt.Sprintf("sql connection not found: %v", name))
+	}
+	return db, nil
+}
+
+func sqlStatement(args []Argument, container map[string]interface{}) (string, []interface{}, error) {
+	if len(args) < 2 {
+		return "", nil, errors.New("sql statement requires connection name and query.")
+	}
+	query, ok := args[1].rawArg.(string)
+	if !ok {
+		return "", nil, errors.New(fmt.Sprintf("sql query must be string. %v", args[1].rawArg))
+	}
+	params, err := evaluateAll(args[2:], container)
+	if err != nil {
+		return "", nil, err
+	}
+	return query, params, nil
+}
+
+func scanRows(rows *sql.Rows) ([]map[string]interface{}, error) {
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	records := []map[string]interface{}{}
+	for rows.Next() {
+		values := make([]interface{}, len(columns))
+		pointers := make([]interface{}, len(columns))
+		for index := range values {
+			pointers[index] = &values[index]
+		}
+		if err := rows.Scan(pointers...); err != nil {
+			return nil, err
+		}
+		record := map[string]interface{}{}
+		for index, column := range columns {
+			switch value := values[index].(type) {
+			case []byte:
+				record[column] = string(value)
+			case int64:
+				record[column] = int(value)
+			default:
+				record[column] = value
+			}
+		}
+		records = append(records, record)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return records, nil
+}
+
+func init() {
+	DslFunctions["sqlOpen"] = func(container map[string]interface{}, args ...Argument) (interface{}, error) {
+		evaluated, err := evaluateAll(args, container)
+		if err != nil {
+			return nil, err
+		}
+		if len(evaluated) < 3 {
+			return nil, errors.New("sqlOpen requires name, driver and dsn.")
+		}
+		name, nameOk := evaluated[0].(string)
+		driverName, driverOk := evaluated[1].(string)
+		dsn, dsnOk := evaluated[2].(string)
+		if !nameOk || !driverOk || !dsnOk {
+			return nil, errors.New(fmt.Sprintf("sqlOpen arguments must be string. %v", evaluated))
+		}
+		db, err := sql.Open(driverName, dsn)
+		if err != nil {
+			return nil, err
+		}
+		if err := db.Ping(); err != nil {
+			db.Close()
+			return nil, err
+		}
+		sqlConnectionsMutex.Lock()
+		if old, ok := sqlConnections[name]; ok {
+			old.Close()
+		}
+		sqlConnections[name] = db
+		sqlConnectionsMutex.Unlock()
+		return nil, nil
+	}
+
+	DslFunctions["sqlClose"] = func(container map[string]interface{}, args ...Argument) (interface{}, error) {
+		name, ok := args[0].rawArg.(string)
+		if !ok {
+			return nil, errors.New(fmt.Sprintf("sql connection name must be string. %v", args[0].rawArg))
+		}
+		sqlConnectionsMutex.Lock()
+		defer sqlConnectionsMutex.Unlock()
+		db, ok := sqlConnections[name]
+		if !ok {
+			return nil, errors.New(fmt.Sprintf("sql connection not found: %v", name))
+		}
+		delete(sqlConnections, name)
+		return nil, db.Close()
+	}
+
+	DslFunctions["sqlQuery"] = func(container map[string]interface{}, args ...Argument) (interface{}, error) {
+		runner, err := sqlRunnerFor(container, args[0])
+		if err != nil {
+			return nil, err
+		}
+		query, params, err := sqlStatement(args, container)
+		if err != nil {
+			return nil, err
+		}
+		rows, err := runner.QueryContext(containerContext(container), query, params...)
+		if err != nil {
+			return nil, err
+		}
+		defer rows.Close()
+		return scanRows(rows)
+	}
+
+	DslFunctions["sqlExec"] = func(container map[string]interface{}, args ...Argument) (interface{}, error) {
+		runner, err := sqlRunnerFor(container, args[0])
+		if err != nil {
+			return nil, err
+		}
+		query, params, err := sqlStatement(args, container)
+		if err != nil {
+			return nil, err
+		}
+		res, err := runner.ExecContext(containerContext(container), query, params...)
+		if err != nil {
+			return nil, err
+		}
+		result := map[string]interface{}{}
+		if rowsAffected, err := res.RowsAffected(); err == nil {
+			result["rowsAffected"] = int(rowsAffected)
+		}
+		if lastInsertId, err := res.LastInsertId(); err == nil {
+			result["lastInsertId"] = int(lastInsertId)
+		}
+		return result, nil
+	}
+
+	DslFunctions["sqlTx"] = func(container map[string]interface{}, args ...Argument) (interface{}, error) {
+		name, ok := args[0].rawArg.(string)
+		if !ok {
+			return nil, errors.New(fmt.Sprintf("sql connection name must be string. %v", args[0].rawArg))
+		}
+		sqlConnectionsMutex.RLock()
+		db, ok := sqlConnections[name]
+		sqlConnectionsMutex.RUnlock()
+		if !ok {
+			return nil, errors.New(fmt.Sprintf("sql connection not found: %v", name))
+		}
+		tx, err := db.BeginTx(containerContext(container), nil)
+		if err != nil {
+			return nil, err
+		}
+		previous, hadPrevious := container["sqlTx"]
+		transactions := map[string]*sql.Tx{}
+		if typed, ok := previous.(map[string]*sql.Tx); ok {
+			for key, value := range typed {
+				transactions[key] = value
+			}
+		}
+		transactions[name] = tx
+		container["sqlTx"] = transactions
+		finished := false
+		defer func() {
+			if !finished {
+				tx.Rollback()
+			}
+			if hadPrevious {
+				container["sqlTx"] = previous
+			} else {
+				delete(container, "sqlTx")
+			}
+		}()
+		result, err := args[1].Evaluate(container)
+		finished = true
+		if err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+		if err := tx.Commit(); err != nil {
+			return nil, err
+		}
+		return result, nil
+	}
+}
@@ -0,0 +1,102 @@
+package mydslgo
+
+import (
+	"context"
+	"fmt"
+	_ "github.com/mattn/go-sqlite3"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func openTestDatabase(t *testing.T, container map[string]interface{}, name string) {
+	t.Helper()
+	dsn := filepath.Join(t.TempDir(), name+".db") + "?_busy_timeout=100"
+	mustEvaluateYaml(t, container, fmt.Sprintf("sqlOpen: [%v, sqlite3, %q]", name, dsn))
+	mustEvaluateYaml(t, container, fmt.Sprintf("sqlExec: [%v, 'CREATE TABLE items (id INTEGER PRIMARY KEY, name TEXT)']", name))
+	t.Cleanup(func() {
+		DslFunctions["sqlClose"](container, NewArgument(name))
+	})
+}
+
+func TestSqlQueryAndExec(t *testing.T) {
+	container := map[string]interface{}{"name": "apple"}
+	openTestDatabase(t, container, "sqlQueryAndExec")
+	result := mustEvaluateYaml(t, container, "sqlExec: [sqlQueryAndExec, 'INSERT INTO items (name) VALUES (?)', $.name]")
+	if !reflect.DeepEqual(result, map[string]interface{}{"rowsAffected": 1, "lastInsertId": 1}) {
+		t.Fatalf("unexpected exec result: %v", result)
+	}
+	rows := mustEvaluateYaml(t, container, "sqlQuery: [sqlQueryAndExec, 'SELECT id, name FROM items WHERE name = ?', apple]")
+	expected := []map[string]interface{}{{"id": 1, "name": "apple"}}
+	if !reflect.DeepEqual(rows, expected) {
+		t.Fatalf("unexpected rows: %v", rows)
+	}
+	if _, err := evaluateYaml(t, container, "sqlQuery: [missing, 'SELECT 1']"); err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Fatalf("expected missing connection error, got %v", err)
+	}
+}
+
+func TestSqlTxCommitAndRollback(t *testing.T) {
+	container := map[string]interface{}{}
+	openTestDatabase(t, container, "sqlTxCommit")
+	mustEvaluateYaml(t, container, "sqlTx: [sqlTxCommit, {sqlExec: [sqlTxCommit, \"INSERT INTO items (name) VALUES ('kept')\"]}]")
+	_, err := evaluateYaml(t, container, "sqlTx: [sqlTxCommit, {sqlExec: [sqlTxCommit, \"INSERT INTO missing (name) VALUES ('lost')\"]}]")
+	if err == nil {
+		t.Fatal("expected failing statement to abort the transaction")
+	}
+	rows := mustEvaluateYaml(t, container, "sqlQuery: [sqlTxCommit, 'SELECT name FROM items']")
+	if !reflect.DeepEqual(rows, []map[string]interface{}{{"name": "kept"}}) {
+		t.Fatalf("unexpected rows: %v", rows)
+	}
+	if _, ok := container["sqlTx"]; ok {
+		t.Fatal("sqlTx should be removed after the transaction")
+	}
+}
+
+func TestSqlTxNestedConnections(t *testing.T) {
+	container := map[string]interface{}{}
+	openTestDatabase(t, container, "sqlTxOuter")
+	openTestDatabase(t, container, "sqlTxInner")
+	mustEvaluateYaml(t, container, `
+sqlTx:
+  - sqlTxOuter
+  - sequence:
+    - sqlExec: [sqlTxOuter, "INSERT INTO items (name) VALUES ('before')"]
+    - $.inner:
+        sqlTx: [sqlTxInner, {sqlExec: [sqlTxInner, "INSERT INTO items (name) VALUES ('inner')"]}]
+    - $.after:
+        sqlExec: [sqlTxOuter, "INSERT INTO items (name) VALUES ('after')"]
+`)
+	if container["after"] == nil {
+		t.Fatal("statement after nested sqlTx did not run inside the outer transaction")
+	}
+	rows := mustEvaluateYaml(t, container, "sqlQuery: [sqlTxOuter, 'SELECT name FROM items ORDER BY id']")
+	if !reflect.DeepEqual(rows, []map[string]interface{}{{"name": "before"}, {"name": "after"}}) {
+		t.Fatalf("unexpected outer rows: %v", rows)
+	}
+	rows = mustEvaluateYaml(t, container, "sqlQuery: [sqlTxInner, 'SELECT name FROM items']")
+	if !reflect.DeepEqual(rows, []map[string]interface{}{{"name": "inner"}}) {
+		t.Fatalf("unexpected inner rows: %v", rows)
+	}
+}
+
+func TestSqlUsesContainerContext(t *testing.T) {
+	container := map[string]interface{}{}
+	openTestDatabase(t, container, "sqlContext")
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	cancelled := map[string]interface{}{"context": ctx}
+	for _, src := range []string{
+		"sqlQuery: [sqlContext, 'SELECT 1']",
+		"sqlExec: [sqlContext, \"INSERT INTO items (name) VALUES ('x')\"]",
+		"sqlTx: [sqlContext, null]",
+	} {
+		if _, err := evaluateYaml(t, cancelled, src); err == nil {
+			t.Errorf("%v: expected cancelled context error", src)
+		}
+	}
+	if rows := mustEvaluateYaml(t, container, "sqlQuery: [sqlContext, 'SELECT name FROM items']"); !reflect.DeepEqual(rows, []map[string]interface{}{}) {
+		t.Fatalf("unexpected rows: %v", rows)
+	}
+}
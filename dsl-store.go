@@ -0,0 +1,283 @@
+package mydslgo
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+)
+
+type storeNamespace struct {
+	mutex    sync.Mutex
+	values   map[string]interface{}
+	keyLocks map[string]chan struct{}
+	path     string
+}
+
+var stores = map[string]*storeNamespace{}
+var storesMutex = sync.Mutex{}
+
+func namespaceStore(name string) *storeNamespace {
+	storesMutex.Lock()
+	defer storesMutex.Unlock()
+	store, ok := stores[name]
+	if !ok {
+		store = &storeNamespace{values: map[string]interface{}{}, keyLocks: map[string]chan struct{}{}}
+		stores[name] = store
+	}
+	return store
+}
+
+func containerStore(container map[string]interface{}) *storeNamespace {
+	if name, ok := container["storeNamespace"].(string); ok {
+		return namespaceStore(name)
+	}
+	if name, ok := container["processId"].(string); ok {
+		return namespaceStore(name)
+	}
+	return namespaceStore("default")
+}
+
+func (store *storeNamespace) load(path string) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	if store.path == path {
+		return nil
+	}
+	b, err := ioutil.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err == nil && len(b) > 0 {
+		loaded := map[string]interface{}{}
+		if err := json.Unmarshal(b, &loaded); err != nil {
+			return errors.New(fmt.Sprintf("store file %v: %v", path, err))
+		}
+		for key, value := range loaded {
+			store.values[key] = fromJsonNumbers(value)
+		}
+	}
+	store.path = path
+	return store.persist()
+}
+
+func (store *storeNamespace) persist() error {
+	if store.path == "" {
+		return nil
+	}
+	b, err := json.Marshal(store.values)
+	if err != nil {
+		return err
+	}
+	temporary := store.path + ".tmp"
+	if err := ioutil.WriteFile(temporary, b, 0644); err != nil {
+		return err
+	}
+	return os.Rename(temporary, store.path)
+}
+
+func (store *storeNamespace) get(key string) (interface{}, bool) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	value, ok := store.values[key]
+	return toJsonCompatible(value), ok
+}
+
+func (store *storeNamespace) set(key string, value interface{}) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	if value == nil {
+		delete(store.values, key)
+	} else {
+		store.values[key] = toJsonCompatible(value)
+	}
+	return store.persist()
+}
+
+func (store *storeNamespace) incr(key string, delta int) (int, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	current := 0
+	if value, ok := store.values[key]; ok {
+		typed, ok := value.(int)
+		if !ok {
+			return 0, errors.New(fmt.Sprintf("storeIncr %v is not int. %v", key, value))
+		}
+		current = typed
+	}
+	store.values[key] = current + delta
+	return current + delta, store.persist()
+}
+
+func (store *storeNamespace) compareAndSwap(key string, expected interface{}, value interface{}) (bool, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	if !reflect.DeepEqual(store.values[key], toJsonCompatible(expected)) {
+		return false, nil
+	}
+	if value == nil {
+		delete(store.values, key)
+	} else {
+		store.values[key] = toJsonCompatible(value)
+	}
+	return true, store.persist()
+}
+
+func (store *storeNamespace) keys(prefix string) []interface{} {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	keys := []string{}
+	for key := range store.values {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	result := []interface{}{}
+	for _, key := range keys {
+		result = append(result, key)
+	}
+	return result
+}
+
+// keyLock returns a one slot channel used as a mutex, so waiting for it can
+// be abandoned when the container context is done.
+func (store *storeNamespace) keyLock(key string) chan struct{} {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	lock, ok := store.keyLocks[key]
+	if !ok {
+		lock = make(chan struct{}, 1)
+		store.keyLocks[key] = lock
+	}
+	return lock
+}
+
+func evaluateStoreKey(name string, container map[string]interface{}, arg Argument) (string, error) {
+	evaluated, err := arg.Evaluate(container)
+	if err != nil {
+		return "", err
+	}
+	key, ok := evaluated.(string)
+	if !ok {
+		return "", errors.New(fmt.Sprintf("%v key must be string. %v", name, evaluated))
+	}
+	return key, nil
+}
+
+func init() {
+	DslFunctions["storeOpen"] = func(container map[string]interface{}, args ...Argument) (interface{}, error) {
+		name, err := evaluateStoreKey("storeOpen", container, args[0])
+		if err != nil {
+			return nil, err
+		}
+		container["storeNamespace"] = name
+		if len(args) < 2 {
+			return nil, nil
+		}
+		evaluated, err := args[1].Evaluate(container)
+		if err != nil {
+			return nil, err
+		}
+		options, ok := toStringKeyMap(evaluated)
+		if !ok {
+			return nil, errors.New(fmt.Sprintf("storeOpen options must be map. %v", evaluated))
+		}
+		if path, ok := options["file"].(string); ok && path != "" {
+			return nil, namespaceStore(name).load(path)
+		}
+		return nil, nil
+	}
+
+	DslFunctions["storeGet"] = func(container map[string]interface{}, args ...Argument) (interface{}, error) {
+		key, err := evaluateStoreKey("storeGet", container, args[0])
+		if err != nil {
+			return nil, err
+		}
+		value, ok := containerStore(container).get(key)
+		if !ok && len(args) > 1 {
+			return args[1].Evaluate(container)
+		}
+		return value, nil
+	}
+
+	DslFunctions["storeSet"] = func(container map[string]interface{}, args ...Argument) (interface{}, error) {
+		key, err := evaluateStoreKey("storeSet", container, args[0])
+		if err != nil {
+			return nil, err
+		}
+		value, err := args[1].Evaluate(container)
+		if err != nil {
+			return nil, err
+		}
+		return value, containerStore(container).set(key, value)
+	}
+
+	DslFunctions["storeIncr"] = func(container map[string]interface{}, args ...Argument) (interface{}, error) {
+		key, err := evaluateStoreKey("storeIncr", container, args[0])
+		if err != nil {
+			return nil, err
+		}
+		delta := 1
+		if len(args) > 1 {
+			evaluated, err := args[1].Evaluate(container)
+			if err != nil {
+				return nil, err
+			}
+			delta, err = toInt(evaluated)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return containerStore(container).incr(key, delta)
+	}
+
+	DslFunctions["storeCas"] = func(container map[string]interface{}, args ...Argument) (interface{}, error) {
+		key, err := evaluateStoreKey("storeCas", container, args[0])
+		if err != nil {
+			return nil, err
+		}
+		expected, err := args[1].Evaluate(container)
+		if err != nil {
+			return nil, err
+		}
+		value, err := args[2].Evaluate(container)
+		if err != nil {
+			return nil, err
+		}
+		return containerStore(container).compareAndSwap(key, expected, value)
+	}
+
+	DslFunctions["storeKeys"] = func(container map[string]interface{}, args ...Argument) (interface{}, error) {
+		prefix := ""
+		if len(args) > 0 {
+			evaluated, err := evaluateStoreKey("storeKeys", container, args[0])
+			if err != nil {
+				return nil, err
+			}
+			prefix = evaluated
+		}
+		return containerStore(container).keys(prefix), nil
+	}
+
+	DslFunctions["storeLock"] = func(container map[string]interface{}, args ...Argument) (interface{}, error) {
+		key, err := evaluateStoreKey("storeLock", container, args[0])
+		if err != nil {
+			return nil, err
+		}
+		lock := containerStore(container).keyLock(key)
+		ctx := containerContext(container)
+		select {
+		case lock <- struct{}{}:
+		case <-ctx.Done():
+			return nil, errors.New(fmt.Sprintf("storeLock: cancelled waiting for %v: %v", key, ctx.Err()))
+		}
+		defer func() { <-lock }()
+		return args[1].Evaluate(container)
+	}
+}
@@ -0,0 +1,216 @@
+package mydslgo
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+type templateSettings struct {
+	dir       string
+	partials  string
+	layout    string
+	errorPage string
+	dev       bool
+}
+
+type cachedTemplate struct {
+	template *template.Template
+	files    []string
+	modTime  time.Time
+}
+
+var templateOptions = templateSettings{dir: "templates", partials: "partials"}
+var templateCache = map[string]*cachedTemplate{}
+var templateMutex = sync.RWMutex{}
+var templateFuncMutex = sync.Mutex{}
+
+func serializedTemplateFunc(function interface{}) interface{} {
+	dslFunction, ok := function.(func(...interface{}) (interface{}, error))
+	if !ok {
+		return function
+	}
+	return func(args ...interface{}) (interface{}, error) {
+		templateFuncMutex.Lock()
+		defer templateFuncMutex.Unlock()
+		return dslFunction(args...)
+	}
+}
+
+func templateFiles(name string, layout string) ([]string, error) {
+	files := []string{}
+	if layout != "" {
+		files = append(files, filepath.Join(templateOptions.dir, layout))
+	}
+	if templateOptions.partials != "" {
+		partials, err := filepath.Glob(filepath.Join(templateOptions.dir, templateOptions.partials, "*"))
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, partials...)
+	}
+	return append(files, filepath.Join(templateOptions.dir, name)), nil
+}
+
+func latestModTime(files []string) (time.Time, error) {
+	latest := time.Time{}
+	for _, file := range files {
+		info, err := os.Stat(file)
+		if err != nil {
+			return latest, err
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest, nil
+}
+
+func loadTemplate(name string, layout string) (*template.Template, error) {
+	cacheKey := layout + "|" + name
+	templateMutex.RLock()
+	cached, ok := templateCache[cacheKey]
+	dev := templateOptions.dev
+	templateMutex.RUnlock()
+	if ok && !dev {
+		return cached.template, nil
+	}
+	templateMutex.Lock()
+	defer templateMutex.Unlock()
+	files, err := templateFiles(name, layout)
+	if err != nil {
+		return nil, err
+	}
+	modTime, err := latestModTime(files)
+	if err != nil {
+		return nil, err
+	}
+	if cached, ok := templateCache[cacheKey]; ok && !modTime.After(cached.modTime) && len(files) == len(cached.files) {
+		return cached.template, nil
+	}
+	parsed, err := template.New(filepath.Base(files[0])).Funcs(templateFuncs).ParseFiles(files...)
+	if err != nil {
+		return nil, err
+	}
+	templateCache[cacheKey] = &cachedTemplate{template: parsed, files: files, modTime: modTime}
+	return parsed, nil
+}
+
+func renderTemplate(res http.ResponseWriter, name string, layout string, data interface{}) error {
+	if layout == "" {
+		templateMutex.RLock()
+		layout = templateOptions.layout
+		templateMutex.RUnlock()
+	}
+	buffer := &bytes.Buffer{}
+	t, err := loadTemplate(name, layout)
+	if err == nil {
+		entry := filepath.Base(name)
+		if layout != "" {
+			entry = filepath.Base(layout)
+		}
+		err = t.ExecuteTemplate(buffer, entry, data)
+	}
+	if err != nil {
+		log.Println("render:", name, err)
+		renderErrorPage(res, name, err)
+		return err
+	}
+	_, err = buffer.WriteTo(res)
+	return err
+}
+
+func renderErrorPage(res http.ResponseWriter, name string, renderErr error) {
+	templateMutex.RLock()
+	errorPage := templateOptions.errorPage
+	dev := templateOptions.dev
+	templateMutex.RUnlock()
+	message := http.StatusText(http.StatusInternalServerError)
+	if dev {
+		message = renderErr.Error()
+	}
+	if errorPage != "" && errorPage != name {
+		buffer := &bytes.Buffer{}
+		t, err := loadTemplate(errorPage, "")
+		if err == nil {
+			err = t.ExecuteTemplate(buffer, filepath.Base(errorPage), map[string]interface{}{"status": http.StatusInternalServerError, "error": message, "template": name})
+		}
+		if err == nil {
+			res.WriteHeader(http.StatusInternalServerError)
+			buffer.WriteTo(res)
+			return
+		}
+		log.Println("render error page:", errorPage, err)
+	}
+	http.Error(res, message, http.StatusInternalServerError)
+}
+
+func init() {
+	DslFunctions["templateConfig"] = func(container map[string]interface{}, args ...Argument) (interface{}, error) {
+		evaluated, err := args[0].Evaluate(container)
+		if err != nil {
+			return nil, err
+		}
+		options, ok := toStringKeyMap(evaluated)
+		if !ok {
+			return nil, errors.New(fmt.Sprintf("templateConfig argument must be map. %v", evaluated))
+		}
+		templateMutex.Lock()
+		defer templateMutex.Unlock()
+		for key, value := range options {
+			switch key {
+			case "dev":
+				dev, ok := value.(bool)
+				if !ok {
+					return nil, errors.New(fmt.Sprintf("templateConfig dev must be bool. %v", value))
+				}
+				templateOptions.dev = dev
+			case "dir", "partials", "layout", "errorPage":
+				stringValue := ""
+				if value != nil {
+					stringValue = fmt.Sprint(value)
+				}
+				switch key {
+				case "dir":
+					templateOptions.dir = stringValue
+				case "partials":
+					templateOptions.partials = stringValue
+				case "layout":
+					templateOptions.layout = stringValue
+				case "errorPage":
+					templateOptions.errorPage = stringValue
+				}
+			default:
+				return nil, errors.New(fmt.Sprintf("templateConfig unknown option: %v", key))
+			}
+		}
+		templateCache = map[string]*cachedTemplate{}
+		return nil, nil
+	}
+
+	DslFunctions["templateFunc"] = func(container map[string]interface{}, args ...Argument) (interface{}, error) {
+		name, ok := args[0].rawArg.(string)
+		if !ok {
+			return nil, errors.New(fmt.Sprintf("templateFunc name must be string. %v", args[0].rawArg))
+		}
+		evaluated, err := args[1].Evaluate(container)
+		if err != nil {
+			return nil, err
+		}
+		if !isFunc(evaluated) {
+			return nil, errors.New(fmt.Sprintf("templateFunc %v must be function. %v", name, evaluated))
+		}
+		templateMutex.Lock()
+		defer templateMutex.Unlock()
+		templateFuncs[name] = serializedTemplateFunc(evaluated)
+		templateCache = map[string]*cachedTemplate{}
+		return nil, nil
+	}
+}
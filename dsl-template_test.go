@@ -0,0 +1,41 @@
+package mydslgo
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestTemplateFuncConcurrentRender(t *testing.T) {
+	dir := t.TempDir()
+	if err := ioutil.WriteFile(filepath.Join(dir, "count.html"), []byte(`{{ inc .n }}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	container := map[string]interface{}{"dir": dir}
+	mustEvaluateYaml(t, container, "templateConfig: [{dir: $.dir, partials: null, layout: null}]")
+	mustEvaluateYaml(t, container, "templateFunc: [inc, {function: [[x], {plus: [$.x, 1]}]}]")
+	wg := sync.WaitGroup{}
+	failures := make(chan string, 200)
+	for index := 0; index < 200; index++ {
+		wg.Add(1)
+		go func(index int) {
+			defer wg.Done()
+			recorder := httptest.NewRecorder()
+			if err := renderTemplate(recorder, "count.html", "", map[string]interface{}{"n": index}); err != nil {
+				failures <- err.Error()
+				return
+			}
+			if body := recorder.Body.String(); body != fmt.Sprint(index+1) {
+				failures <- fmt.Sprintf("render %v returned %v", index, body)
+			}
+		}(index)
+	}
+	wg.Wait()
+	close(failures)
+	for failure := range failures {
+		t.Error(failure)
+	}
+}
@@ -0,0 +1,211 @@
+package mydslgo
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+type TypeOptions struct {
+	Fields       []string
+	ReadOnly     []string
+	Methods      []string
+	Constructors map[string]interface{}
+}
+
+type registeredType struct {
+	name     string
+	typ      reflect.Type
+	fields   map[string]int
+	readOnly map[int]bool
+	methods  map[string]bool
+}
+
+var registeredTypes = map[reflect.Type]*registeredType{}
+var registeredTypeNames = map[string]*registeredType{}
+var typesMutex = sync.RWMutex{}
+
+func RegisterType(name string, sample interface{}, options TypeOptions) error {
+	typ := reflect.TypeOf(sample)
+	if typ != nil && typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	if typ == nil || typ.Kind() != reflect.Struct {
+		return errors.New(fmt.Sprintf("RegisterType %v: sample must be struct or pointer to struct. %v", name, sample))
+	}
+	registered := &registeredType{name: name, typ: typ, fields: map[string]int{}, readOnly: map[int]bool{}, methods: map[string]bool{}}
+	exposed := map[string]bool{}
+	for _, exposedName := range options.Fields {
+		exposed[exposedName] = true
+	}
+	for index := 0; index < typ.NumField(); index++ {
+		field := typ.Field(index)
+		if field.PkgPath != "" || fieldName(field) == "-" || !exposed[field.Name] {
+			continue
+		}
+		delete(exposed, field.Name)
+		registered.fields[field.Name] = index
+		registered.fields[fieldName(field)] = index
+	}
+	for exposedName := range exposed {
+		return errors.New(fmt.Sprintf("RegisterType %v: no exported field %v", name, exposedName))
+	}
+	for _, readOnlyName := range options.ReadOnly {
+		index, ok := registered.fields[readOnlyName]
+		if !ok {
+			return errors.New(fmt.Sprintf("RegisterType %v: read only field %v is not exposed", name, readOnlyName))
+		}
+		registered.readOnly[index] = true
+	}
+	pointerType := reflect.PtrTo(typ)
+	for _, methodName := range options.Methods {
+		if _, ok := pointerType.MethodByName(methodName); !ok {
+			return errors.New(fmt.Sprintf("RegisterType %v: no exported method %v", name, methodName))
+		}
+		registered.methods[methodName] = true
+	}
+	for constructorName, constructor := range options.Constructors {
+		if !isFunc(constructor) {
+			return errors.New(fmt.Sprintf("RegisterType %v: constructor %v must be func", name, constructorName))
+		}
+	}
+	typesMutex.Lock()
+	defer typesMutex.Unlock()
+	if previous, ok := registeredTypeNames[name]; ok && previous.typ != typ {
+		return errors.New(fmt.Sprintf("RegisterType %v: name is already registered for %v", name, previous.typ))
+	}
+	registeredTypes[typ] = registered
+	registeredTypeNames[name] = registered
+	for constructorName, constructor := range options.Constructors {
+		DslAvailableFunctions[name+"."+constructorName] = constructor
+	}
+	return nil
+}
+
+func lookupRegisteredType(any interface{}) (*registeredType, reflect.Value, bool) {
+	value := reflect.ValueOf(any)
+	if value.Kind() == reflect.Ptr {
+		if value.IsNil() {
+			return nil, value, false
+		}
+		value = value.Elem()
+	}
+	if value.Kind() != reflect.Struct {
+		return nil, value, false
+	}
+	typesMutex.RLock()
+	defer typesMutex.RUnlock()
+	registered, ok := registeredTypes[value.Type()]
+	return registered, value, ok
+}
+
+func (registered *registeredType) field(key string) (int, bool) {
+	if index, ok := registered.fields[key]; ok {
+		return index, true
+	}
+	for name, index := range registered.fields {
+		if strings.EqualFold(name, key) {
+			return index, true
+		}
+	}
+	return 0, false
+}
+
+func (registered *registeredType) get(parent interface{}, object reflect.Value, key string) (interface{}, error) {
+	if index, ok := registered.field(key); ok {
+		field := object.Field(index)
+		if field.Kind() == reflect.Struct && field.CanAddr() {
+			if _, _, ok := lookupRegisteredType(field.Interface()); ok {
+				return field.Addr().Interface(), nil
+			}
+		}
+		return field.Interface(), nil
+	}
+	if registered.methods[key] {
+		if method := reflect.ValueOf(parent).MethodByName(key); method.IsValid() {
+			return method.Interface(), nil
+		}
+		return nil, errors.New(fmt.Sprintf("%v.%v needs pointer receiver", registered.name, key))
+	}
+	return nil, errors.New(fmt.Sprintf("%v has no exposed field or method %v", registered.name, key))
+}
+
+func (registered *registeredType) set(object reflect.Value, key string, value interface{}) error {
+	index, ok := registered.field(key)
+	if !ok {
+		return errors.New(fmt.Sprintf("%v has no exposed field %v", registered.name, key))
+	}
+	if registered.readOnly[index] {
+		return errors.New(fmt.Sprintf("%v.%v is read only", registered.name, key))
+	}
+	return registered.assign(object, index, key, value)
+}
+
+func (registered *registeredType) assign(object reflect.Value, index int, key string, value interface{}) error {
+	field := object.Field(index)
+	if !field.CanSet() {
+		return errors.New(fmt.Sprintf("%v.%v can not be set on a copy, use a pointer", registered.name, key))
+	}
+	converted, err := convertValue(value, field.Type())
+	if err != nil {
+		return errors.New(fmt.Sprintf("%v.%v: %v", registered.name, key, err))
+	}
+	field.Set(converted)
+	return nil
+}
+
+func objectGet(parent interface{}, key string) (interface{}, bool, error) {
+	registered, object, ok := lookupRegisteredType(parent)
+	if !ok {
+		return nil, false, nil
+	}
+	result, err := registered.get(parent, object, key)
+	return result, true, err
+}
+
+func objectSet(parent interface{}, key string, value interface{}) (bool, error) {
+	registered, object, ok := lookupRegisteredType(parent)
+	if !ok {
+		return false, nil
+	}
+	return true, registered.set(object, key, value)
+}
+
+func init() {
+	DslFunctions["newObject"] = func(container map[string]interface{}, args ...Argument) (interface{}, error) {
+		evaluated, err := evaluateAll(args, container)
+		if err != nil {
+			return nil, err
+		}
+		name, ok := evaluated[0].(string)
+		if !ok {
+			return nil, errors.New(fmt.Sprintf("newObject type name must be string. %v", evaluated[0]))
+		}
+		typesMutex.RLock()
+		registered, ok := registeredTypeNames[name]
+		typesMutex.RUnlock()
+		if !ok {
+			return nil, errors.New(fmt.Sprintf("newObject: type is not registered: %v", name))
+		}
+		object := reflect.New(registered.typ)
+		if len(evaluated) < 2 || evaluated[1] == nil {
+			return object.Interface(), nil
+		}
+		fields, ok := toStringKeyMap(evaluated[1])
+		if !ok {
+			return nil, errors.New(fmt.Sprintf("newObject %v fields must be map. %v", name, evaluated[1]))
+		}
+		for key, value := range fields {
+			index, ok := registered.field(key)
+			if !ok {
+				return nil, errors.New(fmt.Sprintf("%v has no exposed field %v", name, key))
+			}
+			if err := registered.assign(object.Elem(), index, key, value); err != nil {
+				return nil, err
+			}
+		}
+		return object.Interface(), nil
+	}
+}
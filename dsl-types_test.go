@@ -0,0 +1,105 @@
+package mydslgo
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+type typesTestAddress struct {
+	City string `json:"city"`
+}
+
+type typesTestUser struct {
+	ID       int    `json:"id"`
+	Name     string `json:"name"`
+	Age      int64
+	Home     typesTestAddress `json:"home"`
+	Password string
+}
+
+func (u *typesTestUser) Greet(prefix string) string {
+	return prefix + " " + u.Name
+}
+
+func (u *typesTestUser) Rename(name string) error {
+	if name == "" {
+		return errors.New("empty name")
+	}
+	u.Name = name
+	return nil
+}
+
+func (u *typesTestUser) Delete() string {
+	return "deleted"
+}
+
+type typesTestHidden struct {
+	Secret string
+}
+
+func (h *typesTestHidden) Reveal() string {
+	return h.Secret
+}
+
+func TestRegisterTypeWhitelist(t *testing.T) {
+	err := RegisterType("TypesTestUser", typesTestUser{}, TypeOptions{
+		Fields:       []string{"ID", "Name", "Age", "Home"},
+		ReadOnly:     []string{"id"},
+		Methods:      []string{"Greet", "Rename"},
+		Constructors: map[string]interface{}{"New": func(name string) *typesTestUser { return &typesTestUser{ID: 1, Name: name} }},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := RegisterType("TypesTestAddress", &typesTestAddress{}, TypeOptions{Fields: []string{"City"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := RegisterType("TypesTestBad", typesTestUser{}, TypeOptions{Fields: []string{"Missing"}}); err == nil {
+		t.Fatal("expected unknown field error")
+	}
+	container := map[string]interface{}{}
+	mustEvaluateYaml(t, container, "set: [$.user, {do: [TypesTestUser.New, bob]}]")
+	mustEvaluateYaml(t, container, "set: [$.user.age, 42]")
+	mustEvaluateYaml(t, container, "set: [$.user.home.city, Tokyo]")
+	mustEvaluateYaml(t, container, "do: [$.user.Rename, alice]")
+	user := container["user"].(*typesTestUser)
+	if user.Age != 42 || user.Home.City != "Tokyo" || user.Name != "alice" {
+		t.Fatalf("unexpected user: %+v", user)
+	}
+	if greeting := mustEvaluateYaml(t, container, "do: [$.user.Greet, hi]"); greeting != "hi alice" {
+		t.Fatalf("unexpected greeting: %v", greeting)
+	}
+	for _, src := range []string{
+		"get: $.user.Password",
+		"set: [$.user.Password, x]",
+		"set: [$.user.id, 5]",
+		"set: [$.user.age, abc]",
+		"do: [$.user.Delete]",
+		"do: [$.user.Rename, '']",
+	} {
+		if _, err := evaluateYaml(t, container, src); err == nil {
+			t.Errorf("%v: expected error", src)
+		}
+	}
+	created := mustEvaluateYaml(t, container, "newObject: [TypesTestUser, {name: carol, id: 9, home: {city: Osaka}}]")
+	if !reflect.DeepEqual(created, &typesTestUser{ID: 9, Name: "carol", Home: typesTestAddress{City: "Osaka"}}) {
+		t.Fatalf("unexpected object: %+v", created)
+	}
+}
+
+func TestRegisterTypeExposesNothingByDefault(t *testing.T) {
+	if err := RegisterType("TypesTestHidden", typesTestHidden{}, TypeOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	container := map[string]interface{}{"hidden": &typesTestHidden{Secret: "s"}}
+	for _, src := range []string{"get: $.hidden.Secret", "set: [$.hidden.Secret, x]", "do: [$.hidden.Reveal]", "newObject: [TypesTestHidden, {Secret: x}]"} {
+		if _, err := evaluateYaml(t, container, src); err == nil {
+			t.Errorf("%v: expected error", src)
+		}
+	}
+	literal := mustEvaluateYaml(t, container, "new: value")
+	if !reflect.DeepEqual(literal, map[interface{}]interface{}{"new": "value"}) {
+		t.Fatalf("{new: ...} should stay a map literal: %v", literal)
+	}
+}
@@ -0,0 +1,280 @@
+package mydslgo
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+var collectionSchemas = map[string]map[string]interface{}{}
+var collectionSchemasMutex = sync.RWMutex{}
+
+func toStringKeyMap(any interface{}) (map[string]interface{}, bool) {
+	switch typed := any.(type) {
+	case map[string]interface{}:
+		return typed, true
+	case map[interface{}]interface{}:
+		result := map[string]interface{}{}
+		for key, value := range typed {
+			result[fmt.Sprint(key)] = value
+		}
+		return result, true
+	}
+	return nil, false
+}
+
+func toFloat(any interface{}) (float64, bool) {
+	switch value := any.(type) {
+	case int:
+		return float64(value), true
+	case int32:
+		return float64(value), true
+	case int64:
+		return float64(value), true
+	case float64:
+		return value, true
+	}
+	return 0, false
+}
+
+func schemaRegexp(container map[string]interface{}, pattern interface{}) (*regexp.Regexp, error) {
+	switch typed := pattern.(type) {
+	case *regexp.Regexp:
+		return typed, nil
+	case string:
+		if strings.HasPrefix(typed, "$") {
+			break
+		}
+		return regexp.Compile(typed)
+	}
+	evaluated, err := NewArgument(pattern).Evaluate(container)
+	if err != nil {
+		return nil, err
+	}
+	if compiled, ok := evaluated.(*regexp.Regexp); ok {
+		return compiled, nil
+	}
+	return nil, errors.New(fmt.Sprintf("schema pattern must be string or regexp. %v", pattern))
+}
+
+var schemaTypes = map[string]bool{
+	"string": true, "int": true, "integer": true, "number": true, "bool": true, "boolean": true,
+	"object": true, "map": true, "array": true, "any": true, "": true,
+}
+
+func compileSchema(container map[string]interface{}, field string, rawSpec interface{}) (map[string]interface{}, error) {
+	spec, ok := toStringKeyMap(rawSpec)
+	if !ok {
+		return nil, errors.New(fmt.Sprintf("schema for %v must be map. %v", field, rawSpec))
+	}
+	compiled := map[string]interface{}{}
+	for key, value := range spec {
+		compiled[key] = value
+	}
+	if rawType, ok := spec["type"]; ok {
+		if typeName, ok := rawType.(string); !ok || !schemaTypes[typeName] {
+			return nil, errors.New(fmt.Sprintf("schema for %v has unknown type. %v", field, rawType))
+		}
+	}
+	if pattern, ok := spec["pattern"]; ok {
+		compiledPattern, err := schemaRegexp(container, pattern)
+		if err != nil {
+			return nil, err
+		}
+		compiled["pattern"] = compiledPattern
+	}
+	if rawProperties, ok := spec["properties"]; ok {
+		properties, ok := toStringKeyMap(rawProperties)
+		if !ok {
+			return nil, errors.New(fmt.Sprintf("schema properties for %v must be map. %v", field, rawProperties))
+		}
+		compiledProperties := map[string]interface{}{}
+		for key, value := range properties {
+			compiledProperty, err := compileSchema(container, childField(field, key), value)
+			if err != nil {
+				return nil, err
+			}
+			compiledProperties[key] = compiledProperty
+		}
+		compiled["properties"] = compiledProperties
+	}
+	if items, ok := spec["items"]; ok {
+		compiledItems, err := compileSchema(container, childField(field, "items"), items)
+		if err != nil {
+			return nil, err
+		}
+		compiled["items"] = compiledItems
+	}
+	return compiled, nil
+}
+
+func matchesType(typeName string, value interface{}) bool {
+	switch typeName {
+	case "string":
+		_, ok := value.(string)
+		return ok
+	case "int", "integer":
+		switch value.(type) {
+		case int, int32, int64:
+			return true
+		}
+		return false
+	case "number":
+		_, ok := toFloat(value)
+		return ok
+	case "bool", "boolean":
+		_, ok := value.(bool)
+		return ok
+	case "object", "map":
+		_, ok := toStringKeyMap(value)
+		return ok
+	case "array":
+		return value != nil && reflect.TypeOf(value).Kind() == reflect.Slice
+	case "any", "":
+		return true
+	}
+	return false
+}
+
+func fieldError(field string, message string) map[string]interface{} {
+	return map[string]interface{}{"field": field, "message": message}
+}
+
+func childField(parent string, key string) string {
+	if parent == "" {
+		return key
+	}
+	return parent + "." + key
+}
+
+func validateValue(field string, value interface{}, spec map[string]interface{}) []interface{} {
+	fieldErrors := []interface{}{}
+	if typeName, ok := spec["type"].(string); ok && !matchesType(typeName, value) {
+		return append(fieldErrors, fieldError(field, fmt.Sprintf("must be %v", typeName)))
+	}
+	size, hasSize := toFloat(value)
+	switch typedValue := value.(type) {
+	case string:
+		size, hasSize = float64(len([]rune(typedValue))), true
+	default:
+		if value != nil && reflect.TypeOf(value).Kind() == reflect.Slice {
+			size, hasSize = float64(reflect.ValueOf(value).Len()), true
+		}
+	}
+	if min, ok := toFloat(spec["min"]); ok && hasSize && size < min {
+		fieldErrors = append(fieldErrors, fieldError(field, fmt.Sprintf("must be at least %v", spec["min"])))
+	}
+	if max, ok := toFloat(spec["max"]); ok && hasSize && size > max {
+		fieldErrors = append(fieldErrors, fieldError(field, fmt.Sprintf("must be at most %v", spec["max"])))
+	}
+	if compiled, ok := spec["pattern"].(*regexp.Regexp); ok {
+		if typedValue, ok := value.(string); ok && !compiled.MatchString(typedValue) {
+			fieldErrors = append(fieldErrors, fieldError(field, fmt.Sprintf("must match %v", compiled.String())))
+		}
+	}
+	if object, ok := toStringKeyMap(value); ok {
+		required := []interface{}{}
+		if spec["required"] != nil {
+			required = toInterfaceSlice(spec["required"])
+		}
+		for _, requiredKey := range required {
+			key := fmt.Sprint(requiredKey)
+			if fieldValue, ok := object[key]; !ok || fieldValue == nil {
+				fieldErrors = append(fieldErrors, fieldError(childField(field, key), "is required"))
+			}
+		}
+		if properties, ok := spec["properties"].(map[string]interface{}); ok {
+			keys := []string{}
+			for key := range properties {
+				keys = append(keys, key)
+			}
+			sort.Strings(keys)
+			for _, key := range keys {
+				fieldValue, ok := object[key]
+				if !ok || fieldValue == nil {
+					continue
+				}
+				fieldErrors = append(fieldErrors, validateValue(childField(field, key), fieldValue, properties[key].(map[string]interface{}))...)
+			}
+		}
+	}
+	if items, ok := spec["items"].(map[string]interface{}); ok && value != nil && reflect.TypeOf(value).Kind() == reflect.Slice {
+		for index, item := range toInterfaceSlice(value) {
+			fieldErrors = append(fieldErrors, validateValue(childField(field, fmt.Sprint(index)), item, items)...)
+		}
+	}
+	return fieldErrors
+}
+
+func schemaArgument(container map[string]interface{}, arg Argument) (interface{}, error) {
+	if _, ok := arg.rawArg.(string); ok {
+		return arg.Evaluate(container)
+	}
+	return arg.rawArg, nil
+}
+
+func validateCollection(collectionName string, obj interface{}) error {
+	collectionSchemasMutex.RLock()
+	spec, ok := collectionSchemas[collectionName]
+	collectionSchemasMutex.RUnlock()
+	if !ok {
+		return nil
+	}
+	fieldErrors := validateValue("", obj, spec)
+	if len(fieldErrors) > 0 {
+		messages := []string{}
+		for _, fieldErr := range fieldErrors {
+			typed := fieldErr.(map[string]interface{})
+			messages = append(messages, fmt.Sprintf("%v %v", typed["field"], typed["message"]))
+		}
+		return errors.New(fmt.Sprintf("%v: validation failed: %v", collectionName, strings.Join(messages, ", ")))
+	}
+	return nil
+}
+
+func init() {
+	DslFunctions["validate"] = func(container map[string]interface{}, args ...Argument) (interface{}, error) {
+		evaluated, err := args[0].Evaluate(container)
+		if err != nil {
+			return nil, err
+		}
+		rawSpec, err := schemaArgument(container, args[1])
+		if err != nil {
+			return nil, err
+		}
+		spec, err := compileSchema(container, "", rawSpec)
+		if err != nil {
+			return nil, err
+		}
+		return validateValue("", evaluated, spec), nil
+	}
+
+	DslFunctions["registerSchema"] = func(container map[string]interface{}, args ...Argument) (interface{}, error) {
+		collectionName, ok := args[0].rawArg.(string)
+		if !ok {
+			return nil, errors.New(fmt.Sprintf("registerSchema collection name must be string. %v", args[0].rawArg))
+		}
+		rawSpec, err := schemaArgument(container, args[1])
+		if err != nil {
+			return nil, err
+		}
+		if rawSpec == nil {
+			collectionSchemasMutex.Lock()
+			delete(collectionSchemas, collectionName)
+			collectionSchemasMutex.Unlock()
+			return nil, nil
+		}
+		spec, err := compileSchema(container, "", rawSpec)
+		if err != nil {
+			return nil, err
+		}
+		collectionSchemasMutex.Lock()
+		collectionSchemas[collectionName] = spec
+		collectionSchemasMutex.Unlock()
+		return nil, nil
+	}
+}
@@ -0,0 +1,105 @@
+package mydslgo
+
+import (
+	"reflect"
+	"testing"
+
+	"gopkg.in/yaml.v2"
+)
+
+func validateErrorFields(t *testing.T, result interface{}) []string {
+	t.Helper()
+	fields := []string{}
+	for _, fieldErr := range result.([]interface{}) {
+		fields = append(fields, fieldErr.(map[string]interface{})["field"].(string))
+	}
+	return fields
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		value  string
+		schema string
+		fields []string
+	}{
+		{"abc", "{type: string}", []string{}},
+		{"1", "{type: string}", []string{""}},
+		{"1", "{type: int}", []string{}},
+		{"1.5", "{type: integer}", []string{""}},
+		{"1.5", "{type: number}", []string{}},
+		{"true", "{type: boolean}", []string{}},
+		{"{a: 1}", "{type: object}", []string{}},
+		{"[1]", "{type: array}", []string{}},
+		{"[1]", "{type: map}", []string{""}},
+		{"null", "{type: any}", []string{}},
+		{"ab", "{type: string, min: 3}", []string{""}},
+		{"abcd", "{type: string, max: 3}", []string{""}},
+		{"5", "{min: 1, max: 10}", []string{}},
+		{"[1, 2]", "{type: array, min: 3}", []string{""}},
+		{"abc123", "{pattern: '^[a-z]+$'}", []string{""}},
+		{"abc", "{pattern: '^[a-z]+$'}", []string{}},
+		{"{name: bob}", "{type: object, required: [name, email]}", []string{"email"}},
+		{"{name: bob, email: null}", "{required: [email]}", []string{"email"}},
+		{
+			"{user: {name: '', age: x}, tags: [a, 1]}",
+			"{properties: {user: {properties: {name: {min: 1}, age: {type: int}}}, tags: {items: {type: string}}}}",
+			[]string{"tags.1", "user.age", "user.name"},
+		},
+		{"{user: {}}", "{properties: {user: {required: [name]}}}", []string{"user.name"}},
+	}
+	for _, test := range tests {
+		var value, schema interface{}
+		if err := yaml.Unmarshal([]byte(test.value), &value); err != nil {
+			t.Fatal(err)
+		}
+		if err := yaml.Unmarshal([]byte(test.schema), &schema); err != nil {
+			t.Fatal(err)
+		}
+		container := map[string]interface{}{"value": value, "schema": schema}
+		result := mustEvaluateYaml(t, container, "validate: [$.value, $.schema]")
+		if fields := validateErrorFields(t, result); !reflect.DeepEqual(fields, test.fields) {
+			t.Errorf("%v against %v: expected errors on %v, got %v", test.value, test.schema, test.fields, result)
+		}
+	}
+}
+
+func TestRegisterSchemaRejectsUnknownType(t *testing.T) {
+	for _, src := range []string{
+		"registerSchema: [validateTestBad, {type: strnig}]",
+		"registerSchema: [validateTestBad, {properties: {name: {type: text}}}]",
+		"registerSchema: [validateTestBad, {items: {type: 1}}]",
+		"registerSchema: [validateTestBad, {pattern: '['}]",
+		"validate: [x, {type: strnig}]",
+	} {
+		if _, err := evaluateYaml(t, map[string]interface{}{}, src); err == nil {
+			t.Errorf("%v: expected error", src)
+		}
+	}
+	collectionSchemasMutex.RLock()
+	_, ok := collectionSchemas["validateTestBad"]
+	collectionSchemasMutex.RUnlock()
+	if ok {
+		t.Fatal("invalid schema should not be registered")
+	}
+}
+
+func TestRegisterSchemaResolvesPatternOnce(t *testing.T) {
+	t.Cleanup(func() {
+		collectionSchemasMutex.Lock()
+		delete(collectionSchemas, "validateTestUsers")
+		collectionSchemasMutex.Unlock()
+	})
+	container := map[string]interface{}{}
+	mustEvaluateYaml(t, container, "set: [$.re, {regexp: '^[a-z]+$'}]")
+	mustEvaluateYaml(t, container, "registerSchema: [validateTestUsers, {properties: {name: {pattern: $.re}}}]")
+	if err := validateCollection("validateTestUsers", map[string]interface{}{"name": "bob"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := validateCollection("validateTestUsers", map[string]interface{}{"name": "Bob1"}); err == nil {
+		t.Fatal("expected pattern error")
+	}
+	mustEvaluateYaml(t, container, "registerSchema: [validateTestUsers, null]")
+	if err := validateCollection("validateTestUsers", map[string]interface{}{"name": "Bob1"}); err != nil {
+		t.Fatal(err)
+	}
+}
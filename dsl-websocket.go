@@ -0,0 +1,335 @@
+package mydslgo
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gorilla/websocket"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+type wsConnection struct {
+	id         string
+	conn       *websocket.Conn
+	writeMutex sync.Mutex
+	rooms      map[string]bool
+}
+
+var wsConnections = map[string]*wsConnection{}
+var wsRooms = map[string]map[string]*wsConnection{}
+var wsAllowedOrigins = []interface{}{}
+var wsMutex = sync.RWMutex{}
+
+func newRandomId() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func checkOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	wsMutex.RLock()
+	allowedOrigins := wsAllowedOrigins
+	wsMutex.RUnlock()
+	if len(allowedOrigins) == 0 {
+		parsed, err := url.Parse(origin)
+		return err == nil && strings.EqualFold(parsed.Host, r.Host)
+	}
+	for _, allowed := range allowedOrigins {
+		if regexpValue, ok := allowed.(*regexp.Regexp); ok {
+			if regexpValue.MatchString(origin) {
+				return true
+			}
+		} else if allowed == "*" || allowed == origin {
+			return true
+		}
+	}
+	return false
+}
+
+func registerConnection(conn *websocket.Conn) *wsConnection {
+	connection := &wsConnection{id: newRandomId(), conn: conn, rooms: map[string]bool{}}
+	wsMutex.Lock()
+	wsConnections[connection.id] = connection
+	wsMutex.Unlock()
+	return connection
+}
+
+func unregisterConnection(connection *wsConnection) {
+	wsMutex.Lock()
+	defer wsMutex.Unlock()
+	for room := range connection.rooms {
+		leaveRoom(connection, room)
+	}
+	delete(wsConnections, connection.id)
+}
+
+func leaveRoom(connection *wsConnection, room string) {
+	delete(connection.rooms, room)
+	if members, ok := wsRooms[room]; ok {
+		delete(members, connection.id)
+		if len(members) == 0 {
+			delete(wsRooms, room)
+		}
+	}
+}
+
+func (connection *wsConnection) write(messageType int, data []byte) error {
+	connection.writeMutex.Lock()
+	defer connection.writeMutex.Unlock()
+	return connection.conn.WriteMessage(messageType, data)
+}
+
+func containerConnection(container map[string]interface{}) (*wsConnection, error) {
+	id, ok := container["connId"].(string)
+	if !ok {
+		return nil, errors.New("connId is not set. websocket builtins must be called inside wsHandler.")
+	}
+	wsMutex.RLock()
+	connection, ok := wsConnections[id]
+	wsMutex.RUnlock()
+	if !ok {
+		return nil, errors.New(fmt.Sprintf("websocket connection not found: %v", id))
+	}
+	return connection, nil
+}
+
+func evaluateRoomName(container map[string]interface{}, arg Argument) (string, error) {
+	evaluated, err := arg.Evaluate(container)
+	if err != nil {
+		return "", err
+	}
+	room, ok := evaluated.(string)
+	if !ok {
+		return "", errors.New(fmt.Sprintf("room name must be string. %v", evaluated))
+	}
+	return room, nil
+}
+
+type wsHandlerOptions struct {
+	routeKey     string
+	routes       map[string]Argument
+	connect      *Argument
+	binary       *Argument
+	malformed    *Argument
+	pingInterval time.Duration
+	readTimeout  time.Duration
+}
+
+func optionalArgument(raw interface{}) *Argument {
+	if raw == nil {
+		return nil
+	}
+	arg := NewArgument(raw)
+	return &arg
+}
+
+func parseWsHandlerOptions(raw interface{}) (*wsHandlerOptions, error) {
+	options := &wsHandlerOptions{routeKey: "type", routes: map[string]Argument{}}
+	if raw == nil {
+		return options, nil
+	}
+	rawOptions, ok := toStringKeyMap(raw)
+	if !ok {
+		return nil, errors.New(fmt.Sprintf("wsHandler options must be map. %v", raw))
+	}
+	if routeKey, ok := rawOptions["routeKey"].(string); ok {
+		options.routeKey = routeKey
+	}
+	if routes, ok := toStringKeyMap(rawOptions["routes"]); ok {
+		for messageType, body := range routes {
+			options.routes[messageType] = NewArgument(body)
+		}
+	}
+	options.connect = optionalArgument(rawOptions["connect"])
+	options.binary = optionalArgument(rawOptions["binary"])
+	options.malformed = optionalArgument(rawOptions["malformed"])
+	for key, target := range map[string]*time.Duration{"pingInterval": &options.pingInterval, "readTimeout": &options.readTimeout} {
+		if rawOptions[key] == nil {
+			continue
+		}
+		duration, err := toDuration(rawOptions[key])
+		if err != nil {
+			return nil, err
+		}
+		*target = duration
+	}
+	if options.pingInterval > 0 && options.readTimeout == 0 {
+		options.readTimeout = options.pingInterval * 2
+	}
+	return options, nil
+}
+
+func (options *wsHandlerOptions) bodyFor(data interface{}, body Argument) Argument {
+	if message, ok := toStringKeyMap(data); ok {
+		if messageType, ok := message[options.routeKey]; ok {
+			if routed, ok := options.routes[fmt.Sprint(messageType)]; ok {
+				return routed
+			}
+		}
+	}
+	return body
+}
+
+func (options *wsHandlerOptions) keepalive(connection *wsConnection, done chan int) {
+	conn := connection.conn
+	if options.readTimeout > 0 {
+		conn.SetReadDeadline(time.Now().Add(options.readTimeout))
+		conn.SetPongHandler(func(string) error {
+			return conn.SetReadDeadline(time.Now().Add(options.readTimeout))
+		})
+	}
+	if options.pingInterval <= 0 {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(options.pingInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(options.pingInterval)); err != nil {
+					return
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+}
+
+func init() {
+	upgrader.CheckOrigin = checkOrigin
+
+	DslFunctions["wsConfig"] = func(container map[string]interface{}, args ...Argument) (interface{}, error) {
+		evaluated, err := args[0].Evaluate(container)
+		if err != nil {
+			return nil, err
+		}
+		options, ok := toStringKeyMap(evaluated)
+		if !ok {
+			return nil, errors.New(fmt.Sprintf("wsConfig argument must be map. %v", evaluated))
+		}
+		if origins, ok := options["origins"]; ok {
+			allowedOrigins := []interface{}{}
+			if origins != nil {
+				allowedOrigins = toInterfaceSlice(origins)
+			}
+			wsMutex.Lock()
+			wsAllowedOrigins = allowedOrigins
+			wsMutex.Unlock()
+		}
+		return nil, nil
+	}
+
+	DslFunctions["wsJoin"] = func(container map[string]interface{}, args ...Argument) (interface{}, error) {
+		connection, err := containerConnection(container)
+		if err != nil {
+			return nil, err
+		}
+		room, err := evaluateRoomName(container, args[0])
+		if err != nil {
+			return nil, err
+		}
+		wsMutex.Lock()
+		defer wsMutex.Unlock()
+		if _, ok := wsRooms[room]; !ok {
+			wsRooms[room] = map[string]*wsConnection{}
+		}
+		wsRooms[room][connection.id] = connection
+		connection.rooms[room] = true
+		return nil, nil
+	}
+
+	DslFunctions["wsLeave"] = func(container map[string]interface{}, args ...Argument) (interface{}, error) {
+		connection, err := containerConnection(container)
+		if err != nil {
+			return nil, err
+		}
+		room, err := evaluateRoomName(container, args[0])
+		if err != nil {
+			return nil, err
+		}
+		wsMutex.Lock()
+		defer wsMutex.Unlock()
+		leaveRoom(connection, room)
+		return nil, nil
+	}
+
+	DslFunctions["wsBroadcast"] = func(container map[string]interface{}, args ...Argument) (interface{}, error) {
+		room, err := evaluateRoomName(container, args[0])
+		if err != nil {
+			return nil, err
+		}
+		evaluated, err := args[1].Evaluate(container)
+		if err != nil {
+			return nil, err
+		}
+		b, err := json.Marshal(toJsonCompatible(evaluated))
+		if err != nil {
+			return nil, err
+		}
+		exceptSelf := false
+		if len(args) > 2 {
+			exceptSelf, _ = args[2].rawArg.(bool)
+		}
+		wsMutex.RLock()
+		members := []*wsConnection{}
+		for id, connection := range wsRooms[room] {
+			if !exceptSelf || id != container["connId"] {
+				members = append(members, connection)
+			}
+		}
+		wsMutex.RUnlock()
+		sent := 0
+		for _, connection := range members {
+			if err := connection.write(websocket.TextMessage, b); err != nil {
+				fmt.Println("wsBroadcast write error", connection.id, err)
+			} else {
+				sent++
+			}
+		}
+		return sent, nil
+	}
+
+	DslFunctions["wsConnections"] = func(container map[string]interface{}, args ...Argument) (interface{}, error) {
+		room := ""
+		if len(args) > 0 {
+			evaluatedRoom, err := evaluateRoomName(container, args[0])
+			if err != nil {
+				return nil, err
+			}
+			room = evaluatedRoom
+		}
+		wsMutex.RLock()
+		defer wsMutex.RUnlock()
+		connections := wsConnections
+		if room != "" {
+			connections = wsRooms[room]
+		}
+		result := []interface{}{}
+		for id, connection := range connections {
+			rooms := []string{}
+			for joined := range connection.rooms {
+				rooms = append(rooms, joined)
+			}
+			sort.Strings(rooms)
+			result = append(result, map[string]interface{}{"id": id, "rooms": rooms, "remoteAddr": connection.conn.RemoteAddr().String()})
+		}
+		sort.Slice(result, func(i, j int) bool {
+			return result[i].(map[string]interface{})["id"].(string) < result[j].(map[string]interface{})["id"].(string)
+		})
+		return result, nil
+	}
+}